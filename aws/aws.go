@@ -13,19 +13,15 @@ import (
 	"github.com/aws/aws-sdk-go/service/route53"
 )
 
-func CreateCfStack(c *Client, name string, instanceType, diskSize, sshKey string) error {
-	svc := cloudformation.New(c.Sess)
-	_, err := svc.CreateStack(&cloudformation.CreateStackInput{
+func CreateCfStack(c *Client, name, sshKey string, opts InstanceOptions) error {
+	input := &cloudformation.CreateStackInput{
 		DisableRollback: aws.Bool(false),
 		Parameters: []*cloudformation.Parameter{{
 			ParameterKey:   aws.String("InstanceType"),
-			ParameterValue: aws.String(instanceType),
-		}, {
-			ParameterKey:   aws.String("SSHLocation"),
-			ParameterValue: aws.String("0.0.0.0/0"),
+			ParameterValue: aws.String(opts.InstanceType),
 		}, {
 			ParameterKey:   aws.String("DiskSize"),
-			ParameterValue: aws.String(diskSize),
+			ParameterValue: aws.String(opts.DiskSize),
 		}, {
 			ParameterKey:   aws.String("SSHKEY"),
 			ParameterValue: aws.String(sshKey),
@@ -35,8 +31,46 @@ func CreateCfStack(c *Client, name string, instanceType, diskSize, sshKey string
 			Key:   aws.String("Name"),
 			Value: aws.String(name),
 		}},
-		TemplateURL: aws.String(c.stackTemplateRUL),
-	})
+	}
+	if c.stackTemplateRUL != "" {
+		// the template of the url knows neither the market nor the arm64 image
+		if opts.Spot {
+			return errors.New("spot instances need the rendered template, unset stack_template_url")
+		}
+		if InstanceArch(opts.InstanceType) == ArchArm64 {
+			return fmt.Errorf("%s needs the arm64 image of the rendered template, unset stack_template_url", opts.InstanceType)
+		}
+		input.TemplateURL = aws.String(c.stackTemplateRUL)
+		input.Parameters = append(input.Parameters, &cloudformation.Parameter{
+			ParameterKey:   aws.String("SSHLocation"),
+			ParameterValue: aws.String("0.0.0.0/0"),
+		})
+	} else {
+		params := c.template
+		params.Arch = InstanceArch(opts.InstanceType)
+		if params.Arch == ArchArm64 {
+			params.AMI = c.armAMI
+		}
+		params.Spot, params.SpotMaxPrice = opts.Spot, opts.SpotMaxPrice
+		body, err := RenderTemplate(params)
+		if err != nil {
+			return err
+		}
+		ca, err := dockerCA(c.dockerCertPath)
+		if err != nil {
+			return err
+		}
+		input.TemplateBody = aws.String(string(body))
+		input.Parameters = append(input.Parameters, &cloudformation.Parameter{
+			ParameterKey:   aws.String("DockerCACert"),
+			ParameterValue: aws.String(ca),
+		})
+		input.Tags = append(input.Tags, &cloudformation.Tag{
+			Key:   aws.String("fx-template-version"),
+			Value: aws.String(TemplateVersion),
+		})
+	}
+	_, err := cloudformation.New(c.Sess).CreateStack(input)
 	if err != nil {
 		return err
 	}
@@ -62,16 +96,16 @@ func GetCfStackIP(c *Client, stackName string) (publicIP, privateIP, instanceId
 	var dns string
 	for _, output := range stacks.Stacks[0].Outputs {
 		switch *output.OutputKey {
-		case "ServerIP":
+		case OutputServerIP:
 			publicIP = *output.OutputValue
 			continue
-		case "ServerID":
+		case OutputServerID:
 			instanceId = *output.OutputValue
 			continue
-		case "PrivateIp":
+		case OutputPrivateIp:
 			privateIP = *output.OutputValue
 			continue
-		case "ServerPubDns":
+		case OutputServerPubDns:
 			dns = *output.OutputValue
 			continue
 		}
@@ -111,6 +145,15 @@ func DeleteCfStackByName(c *Client, stackName string) error {
 	return fmt.Errorf("failed to delete stack")
 }
 
+// DeleteCfStackAndWait deletes the stack and waits until it is gone, so its name can be reused
+func DeleteCfStackAndWait(c *Client, stackName string) error {
+	svc := cloudformation.New(c.Sess)
+	if _, err := svc.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String(stackName)}); err != nil {
+		return err
+	}
+	return svc.WaitUntilStackDeleteComplete(&cloudformation.DescribeStacksInput{StackName: aws.String(stackName)})
+}
+
 func InstanceVolumeSetName(c *Client, instanceId string, name string) error {
 	svc := ec2.New(c.Sess)
 	output, err := svc.DescribeInstanceAttribute(&ec2.DescribeInstanceAttributeInput{
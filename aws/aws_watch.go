@@ -1,120 +1,191 @@
 package aws
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
 )
 
 const namespace = "AWS/EC2"
+const namespaceEBS = "AWS/EBS"
 const period = 300
 
-func GetInstanceStatistics(c *Client, instanceId string, startTime, endTime time.Time) ([]*cloudwatch.MetricDataResult, error) {
-	svc := cloudwatch.New(c.Sess)
-	data, err := svc.GetMetricData(&cloudwatch.GetMetricDataInput{
-		StartTime: aws.Time(startTime),
-		EndTime:   aws.Time(endTime),
-		MetricDataQueries: []*cloudwatch.MetricDataQuery{
-			{
-				Id: aws.String("cpu_utilization_01"),
-				MetricStat: &cloudwatch.MetricStat{
-					Metric: &cloudwatch.Metric{
-						Namespace:  aws.String(namespace),
-						MetricName: aws.String("CPUUtilization"),
-						Dimensions: []*cloudwatch.Dimension{
-							{
-								Name:  aws.String("InstanceId"),
-								Value: aws.String(instanceId),
-							},
-						},
-					},
-					Period: aws.Int64(period),
-					Stat:   aws.String("Average"),
-					Unit:   aws.String("Percent"),
-				},
-				ReturnData: aws.Bool(true),
-			},
-			{
-				Id: aws.String("network_in_01"),
-				MetricStat: &cloudwatch.MetricStat{
-					Metric: &cloudwatch.Metric{
-						Namespace:  aws.String(namespace),
-						MetricName: aws.String("NetworkIn"),
-						Dimensions: []*cloudwatch.Dimension{
-							{
-								Name:  aws.String("InstanceId"),
-								Value: aws.String(instanceId),
-							},
-						},
-					},
-					Period: aws.Int64(period),
-					Stat:   aws.String("Average"),
-					Unit:   aws.String("Bytes"),
-				},
-				ReturnData: aws.Bool(true),
-			},
-			{
-				Id: aws.String("network_out_01"),
-				MetricStat: &cloudwatch.MetricStat{
-					Metric: &cloudwatch.Metric{
-						Namespace:  aws.String(namespace),
-						MetricName: aws.String("NetworkOut"),
-						Dimensions: []*cloudwatch.Dimension{
-							{
-								Name:  aws.String("InstanceId"),
-								Value: aws.String(instanceId),
-							},
-						},
-					},
-					Period: aws.Int64(period),
-					Stat:   aws.String("Average"),
-					Unit:   aws.String("Bytes"),
-				},
-				ReturnData: aws.Bool(true),
-			},
-			{
-				Id: aws.String("network_packets_in_01"),
-				MetricStat: &cloudwatch.MetricStat{
-					Metric: &cloudwatch.Metric{
-						Namespace:  aws.String(namespace),
-						MetricName: aws.String("NetworkPacketsIn"),
-						Dimensions: []*cloudwatch.Dimension{
-							{
-								Name:  aws.String("InstanceId"),
-								Value: aws.String(instanceId),
-							},
-						},
-					},
-					Period: aws.Int64(period),
-					Stat:   aws.String("Average"),
-					Unit:   aws.String("Count"),
-				},
-				ReturnData: aws.Bool(true),
-			},
-			{
-				Id: aws.String("network_packets_out_01"),
-				MetricStat: &cloudwatch.MetricStat{
-					Metric: &cloudwatch.Metric{
-						Namespace:  aws.String(namespace),
-						MetricName: aws.String("NetworkPacketsOut"),
-						Dimensions: []*cloudwatch.Dimension{
-							{
-								Name:  aws.String("InstanceId"),
-								Value: aws.String(instanceId),
-							},
-						},
-					},
-					Period: aws.Int64(period),
-					Stat:   aws.String("Average"),
-					Unit:   aws.String("Count"),
+type watchMetric struct {
+	Namespace string
+	Name      string
+	Stat      string
+	Unit      string
+}
+
+var instanceMetrics = []watchMetric{
+	{namespace, "CPUUtilization", "Average", "Percent"},
+	{namespace, "NetworkIn", "Average", "Bytes"},
+	{namespace, "NetworkOut", "Average", "Bytes"},
+	{namespace, "NetworkPacketsIn", "Average", "Count"},
+	{namespace, "NetworkPacketsOut", "Average", "Count"},
+	{namespace, "DiskReadBytes", "Sum", "Bytes"},
+	{namespace, "DiskWriteBytes", "Sum", "Bytes"},
+	{namespace, "StatusCheckFailed", "Maximum", "Count"},
+	{namespace, "StatusCheckFailed_Instance", "Maximum", "Count"},
+	{namespace, "StatusCheckFailed_System", "Maximum", "Count"},
+}
+
+// the EBS volumes report disk io and burst credits, not the instance
+var volumeMetrics = []watchMetric{
+	{namespaceEBS, "VolumeReadBytes", "Sum", "Bytes"},
+	{namespaceEBS, "VolumeWriteBytes", "Sum", "Bytes"},
+	{namespaceEBS, "VolumeReadOps", "Sum", "Count"},
+	{namespaceEBS, "VolumeWriteOps", "Sum", "Count"},
+	{namespaceEBS, "BurstBalance", "Average", "Percent"},
+}
+
+// MetricSeries the data points of one CloudWatch metric, oldest first
+type MetricSeries struct {
+	Stack      string      `json:"stack,omitempty"`
+	InstanceId string      `json:"instance_id"`
+	VolumeId   string      `json:"volume_id,omitempty"`
+	Metric     string      `json:"metric"`
+	Stat       string      `json:"stat"`
+	Unit       string      `json:"unit"`
+	Timestamps []time.Time `json:"timestamps"`
+	Values     []float64   `json:"values"`
+}
+
+// Latest the most recent value, false without data points
+func (s MetricSeries) Latest() (float64, bool) {
+	if len(s.Values) == 0 {
+		return 0, false
+	}
+	return s.Values[len(s.Values)-1], true
+}
+
+func (s MetricSeries) Average() float64 {
+	if len(s.Values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range s.Values {
+		sum += v
+	}
+	return sum / float64(len(s.Values))
+}
+
+func (s MetricSeries) Max() float64 {
+	var max float64
+	for i, v := range s.Values {
+		if i == 0 || v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// ResolveInstanceId an instance id as is, or the instance of a stack name
+func ResolveInstanceId(c *Client, nameOrId string) (instanceId, stack string, err error) {
+	if strings.HasPrefix(nameOrId, "i-") {
+		return nameOrId, "", nil
+	}
+	_, _, instanceId, err = GetCfStackIP(c, nameOrId)
+	if err == nil && instanceId == "" {
+		err = fmt.Errorf("stack %s has no instance", nameOrId)
+	}
+	return instanceId, nameOrId, err
+}
+
+func instanceVolumes(c *Client, instanceId string) ([]string, error) {
+	volumes, err := ec2.New(c.Sess).DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("attachment.instance-id"), Values: aws.StringSlice([]string{instanceId})}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, volume := range volumes.Volumes {
+		ids = append(ids, aws.StringValue(volume.VolumeId))
+	}
+	return ids, nil
+}
+
+// CheckPeriod rejects the periods CloudWatch does not aggregate by
+func CheckPeriod(d time.Duration) error {
+	if d <= 0 || d%time.Minute != 0 {
+		return fmt.Errorf("period %s is not a positive multiple of 1m", d)
+	}
+	return nil
+}
+
+// GetInstanceStatistics the instance metrics and the metrics of its EBS volumes between startTime and endTime
+func GetInstanceStatistics(c *Client, instanceId string, startTime, endTime time.Time, periodSeconds int64) ([]MetricSeries, error) {
+	if periodSeconds <= 0 {
+		periodSeconds = period
+	}
+	var queries []*cloudwatch.MetricDataQuery
+	var series = make(map[string]*MetricSeries)
+	add := func(metric watchMetric, dimension, value string) {
+		id := fmt.Sprintf("m%d", len(queries))
+		queries = append(queries, &cloudwatch.MetricDataQuery{
+			Id: aws.String(id),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: &cloudwatch.Metric{
+					Namespace:  aws.String(metric.Namespace),
+					MetricName: aws.String(metric.Name),
+					Dimensions: []*cloudwatch.Dimension{{Name: aws.String(dimension), Value: aws.String(value)}},
 				},
-				ReturnData: aws.Bool(true),
+				Period: aws.Int64(periodSeconds),
+				Stat:   aws.String(metric.Stat),
+				Unit:   aws.String(metric.Unit),
 			},
-		},
+			ReturnData: aws.Bool(true),
+		})
+		s := &MetricSeries{InstanceId: instanceId, Metric: metric.Name, Stat: metric.Stat, Unit: metric.Unit}
+		if dimension == "VolumeId" {
+			s.VolumeId = value
+		}
+		series[id] = s
+	}
+	for _, metric := range instanceMetrics {
+		add(metric, "InstanceId", instanceId)
+	}
+	volumes, err := instanceVolumes(c, instanceId)
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		for _, metric := range volumeMetrics {
+			add(metric, "VolumeId", volume)
+		}
+	}
+
+	input := &cloudwatch.GetMetricDataInput{
+		StartTime:         aws.Time(startTime),
+		EndTime:           aws.Time(endTime),
+		MetricDataQueries: queries,
+		ScanBy:            aws.String(cloudwatch.ScanByTimestampAscending),
+	}
+	err = cloudwatch.New(c.Sess).GetMetricDataPages(input, func(page *cloudwatch.GetMetricDataOutput, _ bool) bool {
+		for _, result := range page.MetricDataResults {
+			s, ok := series[aws.StringValue(result.Id)]
+			if !ok {
+				continue
+			}
+			s.Timestamps = append(s.Timestamps, aws.TimeValueSlice(result.Timestamps)...)
+			s.Values = append(s.Values, aws.Float64ValueSlice(result.Values)...)
+		}
+		return true
 	})
 	if err != nil {
 		return nil, err
 	}
-	return data.MetricDataResults, nil
+
+	var res []MetricSeries
+	for i := 0; i < len(queries); i++ {
+		res = append(res, *series[fmt.Sprintf("m%d", i)])
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].VolumeId < res[j].VolumeId })
+	return res, nil
 }
@@ -1,42 +1,148 @@
 package aws
 
 import (
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
+	awsCredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/viper"
 )
 
+// DefRegion the region of the stacks when neither the flags, the config file nor the environment set one
+const DefRegion = "us-east-2"
+
+// ClientConfig the [aws] section of config.toml, --profile and --region override it
+type ClientConfig struct {
+	Profile          string `mapstructure:"profile"`
+	Region           string `mapstructure:"region"`
+	StackTemplateURL string `mapstructure:"stack_template_url"`
+	// RoleArn assumed with the credentials of the chain, MFASerial asks for a token on stdin
+	RoleArn   string `mapstructure:"role_arn"`
+	MFASerial string `mapstructure:"mfa_serial"`
+	// StackTimeout how long a new stack and its docker daemon may take, DefStackTimeout when zero
+	StackTimeout time.Duration `mapstructure:"stack_timeout"`
+
+	// the template rendered when StackTemplateURL is empty
+	AMI          string   `mapstructure:"ami"`
+	AMIArm64     string   `mapstructure:"ami_arm64"`
+	VpcId        string   `mapstructure:"vpc_id"`
+	SubnetId     string   `mapstructure:"subnet_id"`
+	AllowedCIDRs []string `mapstructure:"allowed_cidrs"`
+	DiskType     string   `mapstructure:"disk_type"`
+	DiskIops     int64    `mapstructure:"disk_iops"`
+	// DockerCertPath holds the ca.pem and ca-key.pem signing the docker daemons, docker.CertDir when empty
+	DockerCertPath string `mapstructure:"docker_cert_path"`
+}
+
+// TemplateParams the template parameters of the config
+func (c ClientConfig) TemplateParams() TemplateParams {
+	return TemplateParams{AMI: c.AMI, VpcId: c.VpcId, SubnetId: c.SubnetId, AllowedCIDRs: c.AllowedCIDRs, DiskType: c.DiskType, DiskIops: c.DiskIops}
+}
+
 type Client struct {
 	Region           string
 	stackTemplateRUL string
+	template         TemplateParams
+	armAMI           string
+	dockerCertPath   string
+	stackTimeout     time.Duration
 	Sess             *session.Session
 }
 
-func NewAWSClient(region string, stackTemplateRUL string, sp credentials.StaticProvider) (*Client, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewCredentials(&sp),
-	})
+// GetClientConfig the aws section of the config file with the --profile and --region flags applied
+func GetClientConfig() ClientConfig {
+	var cfg ClientConfig
+	if err := viper.UnmarshalKey("aws", &cfg); err != nil {
+		panic(err.Error())
+	}
+	if profile := viper.GetString("profile"); profile != "" {
+		cfg.Profile = profile
+	}
+	if region := viper.GetString("region"); region != "" {
+		cfg.Region = region
+	}
+	return cfg
+}
+
+// credentialsKey what the credentials of a client depend on, the region aside
+type credentialsKey struct {
+	profile, roleArn, mfaSerial string
+}
+
+// credentials are shared by the clients of every region, so that a token is asked for once,
+// not by each of the goroutines creating a client at the same time
+var credentials = struct {
+	sync.Mutex
+	m map[credentialsKey]*awsCredentials.Credentials
+}{m: make(map[credentialsKey]*awsCredentials.Credentials)}
+
+// NewAWSClient resolves credentials with the SDK chain: env vars, the shared profile
+// (including its role_arn and mfa_serial), then the instance role
+func NewAWSClient(cfg ClientConfig) (*Client, error) {
+	opts := session.Options{
+		Profile:                 cfg.Profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	}
+	if cfg.Region != "" {
+		opts.Config.Region = aws.String(cfg.Region)
+	}
+	sess, err := session.NewSessionWithOptions(opts)
 	if err != nil {
 		return nil, err
 	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(DefRegion)
+	}
 
+	// held while resolving, the callers of the same credentials wait for the first one
+	credentials.Lock()
+	defer credentials.Unlock()
+	key := credentialsKey{profile: cfg.Profile, roleArn: cfg.RoleArn, mfaSerial: cfg.MFASerial}
+	if creds, ok := credentials.m[key]; ok {
+		sess.Config.Credentials = creds
+	} else if cfg.RoleArn != "" {
+		sess.Config.Credentials = stscreds.NewCredentials(sess, cfg.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+			if cfg.MFASerial != "" {
+				p.SerialNumber = aws.String(cfg.MFASerial)
+				p.TokenProvider = stscreds.StdinTokenProvider
+			}
+		})
+	}
+
+	// cached credentials only refresh once expired
 	_, err = sess.Config.Credentials.Get()
 	if err != nil {
 		return nil, err
 	}
+	credentials.m[key] = sess.Config.Credentials
 
-	return &Client{stackTemplateRUL: stackTemplateRUL, Region: region, Sess: sess}, nil
+	if cfg.StackTimeout <= 0 {
+		cfg.StackTimeout = DefStackTimeout
+	}
+	return &Client{
+		stackTemplateRUL: cfg.StackTemplateURL,
+		template:         cfg.TemplateParams(),
+		armAMI:           cfg.AMIArm64,
+		dockerCertPath:   cfg.DockerCertPath,
+		stackTimeout:     cfg.StackTimeout,
+		Region:           aws.StringValue(sess.Config.Region),
+		Sess:             sess,
+	}, nil
 }
 
 func NewDefAWSClient() (*Client, error) {
-	region := "us-east-2"
-	stackTemplateRUL := ""
-
-	return NewAWSClient(region, stackTemplateRUL, credentials.StaticProvider{
-		Value: credentials.Value{
-			AccessKeyID:     "",
-			SecretAccessKey: "",
-		},
-	})
+	return NewAWSClient(GetClientConfig())
+}
+
+// NewRegionAWSClient the default client moved to region, the configured region when empty
+func NewRegionAWSClient(region string) (*Client, error) {
+	cfg := GetClientConfig()
+	if region != "" {
+		cfg.Region = region
+	}
+	return NewAWSClient(cfg)
 }
@@ -3,10 +3,13 @@ package aws
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
+	"fx-tools/inventory"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/spf13/cobra"
@@ -22,7 +25,114 @@ func NewAwsCmd() *cobra.Command {
 	cmd.AddCommand(NewDeleteAllStackCmd())
 	cmd.AddCommand(NewDescribeStacksCmd())
 	cmd.AddCommand(NewGetCostAndUsageCmd())
+	cmd.AddCommand(NewNetworkCostCmd())
 	cmd.AddCommand(NewWatchCmd())
+	cmd.AddCommand(NewTemplateCmd())
+	cmd.AddCommand(NewKeysCmd())
+	return cmd
+}
+
+func NewKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "the ssh keys of the nodes of an inventory network",
+	}
+	rotate := &cobra.Command{
+		Use:     "rotate [node...]",
+		Short:   "authorize a new key on live nodes in place of their current one, every node by default",
+		Example: "fx aws keys rotate --network test validator-0",
+		RunE: func(_ *cobra.Command, args []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			nodes, err := network.Select(args)
+			if err != nil {
+				return err
+			}
+			var failed int
+			for _, node := range nodes {
+				if err = rotateNodeKey(network, node); err != nil {
+					failed++
+					fmt.Printf("%s: %s\n", node.Name, err.Error())
+					continue
+				}
+				// saved per node, a later failure keeps the keys rotated so far
+				if err = network.Save(); err != nil {
+					return err
+				}
+				fmt.Printf("%s: rotated\n", node.Name)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d nodes not rotated", failed, len(nodes))
+			}
+			return nil
+		},
+	}
+	rotate.Flags().String("network", "", "inventory network")
+	_ = rotate.MarkFlagRequired("network")
+	cmd.AddCommand(rotate)
+	return cmd
+}
+
+func rotateNodeKey(network *inventory.Network, node inventory.Node) error {
+	oldKey, err := node.Key()
+	if err != nil {
+		return err
+	}
+	stackName := node.StackName
+	if stackName == "" {
+		stackName = node.Name
+	}
+	err = RotateKey(node.PublicIP, oldKey, func(key []byte) (err error) {
+		node.SSHKey, err = inventory.SaveKey(network.Name, stackName, node.PublicIP, key)
+		return err
+	})
+	if node.SSHKey != "" {
+		network.AddNode(node)
+	}
+	return err
+}
+
+func NewTemplateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "the CloudFormation template of the chain nodes",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:     "render",
+		Short:   "print the template rendered from the [aws] config",
+		Example: "fx aws template render > node.json",
+		RunE: func(*cobra.Command, []string) error {
+			body, err := RenderTemplate(GetClientConfig().TemplateParams())
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(body))
+			return nil
+		},
+	}, &cobra.Command{
+		Use:     "validate [file]",
+		Short:   "check a template offline, the one rendered from the [aws] config by default",
+		Example: "fx aws template validate node.json",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) (err error) {
+			var body []byte
+			if len(args) > 0 {
+				body, err = ioutil.ReadFile(args[0])
+			} else {
+				body, err = RenderTemplate(GetClientConfig().TemplateParams())
+			}
+			if err != nil {
+				return err
+			}
+			if err = ValidateTemplate(body); err != nil {
+				return err
+			}
+			fmt.Printf("template is valid, version %s\n", TemplateVersion)
+			return nil
+		},
+	})
 	return cmd
 }
 
@@ -198,29 +308,89 @@ func NewGetCostAndUsageCmd() *cobra.Command {
 	return cmd
 }
 
+func NewNetworkCostCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "cost",
+		Short:   "cost of every stack of a network by role, usage type and day",
+		Long:    "The stacks are found by their Name tag, which must be activated as a cost allocation tag.",
+		Example: "fx aws cost --network test --start 2020-06-01 --output csv",
+		RunE: func(*cobra.Command, []string) (err error) {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			now := time.Now().UTC()
+			start, err := ParseCostDate(viper.GetString("start"), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				return err
+			}
+			// the end day is excluded, tomorrow includes today
+			end, err := ParseCostDate(viper.GetString("end"), now.AddDate(0, 0, 1))
+			if err != nil {
+				return err
+			}
+			client, err := NewDefAWSClient()
+			if err != nil {
+				return err
+			}
+			report, err := NetworkCost(client, network, start, end)
+			if err != nil {
+				return err
+			}
+			return WriteCostReport(os.Stdout, report, viper.GetString("output"))
+		},
+	}
+	cmd.Flags().String("network", "", "inventory network")
+	cmd.Flags().String("start", "", "first day, yyyy-mm-dd, the first day of the month by default")
+	cmd.Flags().String("end", "", "day after the last day, yyyy-mm-dd, tomorrow by default")
+	cmd.Flags().String("output", "table", "table, csv or json")
+	_ = cmd.MarkFlagRequired("network")
+	return cmd
+}
+
 func NewWatchCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "watch",
-		Example: "fx aws watch fx-chain-ec2-tx-1589446839554265",
-		Args:    cobra.ExactArgs(1),
-		RunE: func(_ *cobra.Command, arg []string) (err error) {
+		Example: "fx aws watch fx-chain-ec2-tx-1589446839554265 i-0a1b2c3d --output csv",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) (err error) {
 			client, err := NewDefAWSClient()
 			if err != nil {
 				return err
 			}
-			start := time.Now().Add(viper.GetDuration("start"))
-			end := time.Now().Add(viper.GetDuration("end"))
-			statistics, err := GetInstanceStatistics(client, arg[0], start, end)
-			if err != nil {
+			if err = CheckPeriod(viper.GetDuration("period")); err != nil {
 				return err
 			}
-			for _, statistic := range statistics {
-				fmt.Println(statistic.String())
+			periodSeconds := int64(viper.GetDuration("period").Seconds())
+			if listen := viper.GetString("serve"); listen != "" {
+				return ServeInstanceStatistics(client, args, listen, viper.GetDuration("interval"), periodSeconds)
 			}
-			return nil
+
+			start := time.Now().Add(viper.GetDuration("start"))
+			end := time.Now().Add(viper.GetDuration("end"))
+			var series []MetricSeries
+			for _, nameOrId := range args {
+				instanceId, stack, err := ResolveInstanceId(client, nameOrId)
+				if err != nil {
+					return err
+				}
+				statistics, err := GetInstanceStatistics(client, instanceId, start, end, periodSeconds)
+				if err != nil {
+					return err
+				}
+				for i := range statistics {
+					statistics[i].Stack = stack
+				}
+				series = append(series, statistics...)
+			}
+			return WriteMetricSeries(os.Stdout, series, viper.GetString("output"))
 		},
 	}
 	cmd.Flags().Duration("start", -48*time.Hour, "")
 	cmd.Flags().Duration("end", -24*time.Hour, "")
+	cmd.Flags().Duration("period", period*time.Second, "CloudWatch period, a multiple of 1m, 1m needs detailed monitoring")
+	cmd.Flags().String("output", "table", "table, csv or json")
+	cmd.Flags().String("serve", "", "serve the latest values as prometheus gauges on this address, e.g. :9106")
+	cmd.Flags().Duration("interval", time.Minute, "poll interval with --serve")
 	return cmd
 }
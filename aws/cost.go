@@ -0,0 +1,237 @@
+package aws
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fx-tools/inventory"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+)
+
+const costDateLayout = "2006-01-02"
+
+type CostItem struct {
+	Date      string  `json:"date"`
+	Stack     string  `json:"stack"`
+	Node      string  `json:"node"`
+	Role      string  `json:"role"`
+	UsageType string  `json:"usage_type"`
+	Cost      float64 `json:"cost"`
+}
+
+type DailyCost struct {
+	Date string  `json:"date"`
+	Cost float64 `json:"cost"`
+}
+
+type CostReport struct {
+	Network     string             `json:"network"`
+	Start       string             `json:"start"`
+	End         string             `json:"end"`
+	Unit        string             `json:"unit"`
+	Total       float64            `json:"total"`
+	ByRole      map[string]float64 `json:"by_role"`
+	ByUsageType map[string]float64 `json:"by_usage_type"`
+	Daily       []DailyCost        `json:"daily"`
+	// MonthToDate the cost since the first day of the current month, within [Start, End)
+	MonthToDate float64 `json:"month_to_date"`
+	// MonthProjection MonthToDate plus the average of the complete days for every remaining day of the month
+	MonthProjection float64    `json:"month_projection"`
+	Items           []CostItem `json:"items"`
+}
+
+// NetworkCost the daily amortized cost of every stack of the network between start and end, end excluded.
+// Stacks are told apart by their Name tag, which must be activated as a cost allocation tag in the billing console
+func NetworkCost(c *Client, network *inventory.Network, start, end time.Time) (*CostReport, error) {
+	var nodes = make(map[string]inventory.Node)
+	var stacks []string
+	for _, node := range network.Nodes {
+		if node.StackName != "" {
+			nodes[node.StackName] = node
+			stacks = append(stacks, node.StackName)
+		}
+	}
+	if len(stacks) == 0 {
+		return nil, fmt.Errorf("network %s has no stacks", network.Name)
+	}
+
+	report := &CostReport{
+		Network:     network.Name,
+		Start:       start.Format(costDateLayout),
+		End:         end.Format(costDateLayout),
+		ByRole:      make(map[string]float64),
+		ByUsageType: make(map[string]float64),
+	}
+	input := &costexplorer.GetCostAndUsageInput{
+		Filter: &costexplorer.Expression{
+			Tags: &costexplorer.TagValues{
+				Key:    aws.String("Name"),
+				Values: aws.StringSlice(stacks),
+			},
+		},
+		Granularity: aws.String("DAILY"),
+		GroupBy: []*costexplorer.GroupDefinition{
+			{Key: aws.String("Name"), Type: aws.String("TAG")},
+			{Key: aws.String("USAGE_TYPE"), Type: aws.String("DIMENSION")},
+		},
+		Metrics: aws.StringSlice([]string{"AmortizedCost"}),
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(report.Start),
+			End:   aws.String(report.End),
+		},
+	}
+	costExplorer := costexplorer.New(c.Sess)
+	var daily = make(map[string]float64)
+	var tagged bool
+	for {
+		usage, err := costExplorer.GetCostAndUsage(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range usage.ResultsByTime {
+			date := aws.StringValue(result.TimePeriod.Start)
+			// days without cost still count
+			if _, ok := daily[date]; !ok {
+				daily[date] = 0
+			}
+			for _, group := range result.Groups {
+				if len(group.Keys) != 2 {
+					continue
+				}
+				metric, ok := group.Metrics["AmortizedCost"]
+				if !ok {
+					continue
+				}
+				cost, err := strconv.ParseFloat(aws.StringValue(metric.Amount), 64)
+				if err != nil {
+					return nil, err
+				}
+				report.Unit = aws.StringValue(metric.Unit)
+				// tag keys come back as "Name$<value>"
+				stack := strings.TrimPrefix(aws.StringValue(group.Keys[0]), "Name$")
+				if stack != "" {
+					tagged = true
+				}
+				node := nodes[stack]
+				item := CostItem{Date: date, Stack: stack, Node: node.Name, Role: node.Role, UsageType: aws.StringValue(group.Keys[1]), Cost: cost}
+				report.Items = append(report.Items, item)
+				report.Total += cost
+				report.ByRole[item.Role] += cost
+				report.ByUsageType[item.UsageType] += cost
+				daily[date] += cost
+			}
+		}
+		if usage.NextPageToken == nil {
+			break
+		}
+		input.NextPageToken = usage.NextPageToken
+	}
+	// cost explorer knows no tag it was not told to allocate by, it reports nothing rather than an error
+	if !tagged {
+		return nil, fmt.Errorf("no cost of the stacks of network %s between %s and %s, "+
+			"the Name tag may not be activated as a cost allocation tag", network.Name, report.Start, report.End)
+	}
+
+	for date, cost := range daily {
+		report.Daily = append(report.Daily, DailyCost{Date: date, Cost: cost})
+	}
+	sort.Slice(report.Daily, func(i, j int) bool { return report.Daily[i].Date < report.Daily[j].Date })
+	report.project(time.Now().UTC())
+	return report, nil
+}
+
+func (r *CostReport) project(now time.Time) {
+	today := now.Format(costDateLayout)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(costDateLayout)
+	var complete float64
+	var completeDays int
+	for _, day := range r.Daily {
+		if day.Date >= monthStart {
+			r.MonthToDate += day.Cost
+		}
+		// today is still being billed
+		if day.Date < today {
+			complete += day.Cost
+			completeDays++
+		}
+	}
+	daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	r.MonthProjection = r.MonthToDate
+	if completeDays > 0 {
+		r.MonthProjection += complete / float64(completeDays) * float64(daysInMonth-now.Day())
+	}
+}
+
+// ParseCostDate a yyyy-mm-dd date, empty for def
+func ParseCostDate(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	return time.Parse(costDateLayout, value)
+}
+
+// WriteCostReport renders the report as tables, csv with one row per item, or json
+func WriteCostReport(w io.Writer, report *CostReport, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"date", "stack", "node", "role", "usage_type", "cost", "unit"}); err != nil {
+			return err
+		}
+		for _, item := range report.Items {
+			if err := cw.Write([]string{item.Date, item.Stack, item.Node, item.Role, item.UsageType,
+				strconv.FormatFloat(item.Cost, 'f', -1, 64), report.Unit}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "network: %s, %s - %s, unit: %s\n\n", report.Network, report.Start, report.End, report.Unit)
+		writeCostTotals(tw, "ROLE", report.ByRole)
+		writeCostTotals(tw, "USAGE TYPE", report.ByUsageType)
+		fmt.Fprintln(tw, "DATE\tCOST")
+		for _, day := range report.Daily {
+			fmt.Fprintf(tw, "%s\t%.2f\n", day.Date, day.Cost)
+		}
+		fmt.Fprintf(tw, "\ntotal: %.2f, month to date: %.2f, month projection: %.2f\n", report.Total, report.MonthToDate, report.MonthProjection)
+		return tw.Flush()
+	default:
+		return errors.New("unknown output: " + output)
+	}
+}
+
+func writeCostTotals(w io.Writer, title string, totals map[string]float64) {
+	var keys []string
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return totals[keys[i]] > totals[keys[j]] })
+	fmt.Fprintf(w, "%s\tCOST\n", title)
+	for _, key := range keys {
+		name := key
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "%s\t%.2f\n", name, totals[key])
+	}
+	fmt.Fprintln(w)
+}
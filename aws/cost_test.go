@@ -0,0 +1,22 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCostReport_Project(t *testing.T) {
+	report := &CostReport{Daily: []DailyCost{
+		{Date: "2020-05-31", Cost: 30},
+		{Date: "2020-06-01", Cost: 10},
+		{Date: "2020-06-02", Cost: 20},
+		{Date: "2020-06-03", Cost: 5},
+	}}
+	report.project(time.Date(2020, 6, 3, 12, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, float64(35), report.MonthToDate)
+	// complete days average 20, 27 days left in june
+	assert.Equal(t, float64(35+20*27), report.MonthProjection)
+}
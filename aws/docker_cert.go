@@ -0,0 +1,73 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fx-tools/docker"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	serverCSRFile  = "/etc/docker/certs/server.csr"
+	serverCertFile = "/etc/docker/certs/server-cert.pem"
+)
+
+// dockerCA the ca.pem of the docker cert dir, a new stack needs its ca-key.pem as well
+// to sign the certificate of the daemon
+func dockerCA(dir string) (string, error) {
+	dir = docker.CertDir(dir)
+	for _, name := range []string{docker.CAFile, docker.CAKeyFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("no docker CA in %q, create it with fx docker certs gen: %s", dir, err.Error())
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, docker.CAFile))
+	return strings.TrimSpace(string(data)), err
+}
+
+// installServerCert signs the certificate request the user data made on the host with the CA,
+// dockerd restarts with TLS once the certificate is in place
+func installServerCert(certDir, ip, privateIP string, key []byte, timeout time.Duration) error {
+	csr, err := readServerCSR(ip, key, timeout)
+	if err != nil {
+		return err
+	}
+	cert, err := docker.SignServerCert(docker.CertDir(certDir), csr, []string{ip, privateIP})
+	if err != nil {
+		return err
+	}
+	client, err := DialSSH(ip, key)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// renamed into place, the user data waits for a complete file
+	_, err = RunSSH(client, fmt.Sprintf("sudo tee %[1]s.new >/dev/null && sudo mv %[1]s.new %[1]s", serverCertFile), bytes.NewReader(cert))
+	return err
+}
+
+// readServerCSR waits for the user data to write the certificate request
+func readServerCSR(ip string, key []byte, timeout time.Duration) (csr []byte, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var client *ssh.Client
+		if client, err = DialSSH(ip, key); err == nil {
+			csr, err = RunSSH(client, "cat "+serverCSRFile, nil)
+			_ = client.Close()
+			if err == nil {
+				return csr, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("read %s of %s: %s", serverCSRFile, ip, err.Error())
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
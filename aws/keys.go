@@ -0,0 +1,69 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RotateKey authorizes a new key on the instance on ip in place of the public key of oldKey,
+// other authorized keys are kept. The new key is appended and handed to save, the old key is only
+// removed once a login with the new one worked. On failure the old key is saved back
+func RotateKey(ip string, oldKey []byte, save func(key []byte) error) error {
+	signer, err := ssh.ParsePrivateKey(oldKey)
+	if err != nil {
+		return err
+	}
+	oldPub := authorizedKey(signer.PublicKey())
+	priKey, pubKey, err := GenSSHKey()
+	if err != nil {
+		return err
+	}
+	newPub := strings.TrimSpace(pubKey)
+
+	client, err := DialSSH(ip, oldKey)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// the keys are base64 and never contain a quote
+	if _, err = RunSSH(client, fmt.Sprintf("echo '%s' >> ~/.ssh/authorized_keys", newPub), nil); err != nil {
+		return err
+	}
+	if err = save([]byte(priKey)); err != nil {
+		return rotateFailed(client, oldKey, save, newPub, fmt.Errorf("save the new key: %s", err.Error()))
+	}
+
+	check, err := DialSSH(ip, []byte(priKey))
+	if err != nil {
+		return rotateFailed(client, oldKey, save, newPub, fmt.Errorf("login with the new key: %s", err.Error()))
+	}
+	defer check.Close()
+	_, err = RunSSH(check, removeKeyScript(oldPub), nil)
+	return err
+}
+
+// rotateFailed takes the new key back off the instance and saves the old one again, both are still authorized
+func rotateFailed(client *ssh.Client, oldKey []byte, save func(key []byte) error, newPub string, cause error) error {
+	if _, err := RunSSH(client, removeKeyScript(strings.Fields(newPub)[1]), nil); err != nil {
+		return fmt.Errorf("%s, remove the new key: %s", cause.Error(), err.Error())
+	}
+	if err := save(oldKey); err != nil {
+		return fmt.Errorf("%s, save the old key: %s", cause.Error(), err.Error())
+	}
+	return cause
+}
+
+// authorizedKey the base64 field of the authorized_keys line of key
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.Fields(string(ssh.MarshalAuthorizedKey(key)))[1]
+}
+
+func removeKeyScript(pub string) string {
+	return fmt.Sprintf(`set -e
+cd ~/.ssh
+{ grep -vF '%s' authorized_keys || true; } > authorized_keys.new
+chmod 600 authorized_keys.new
+mv authorized_keys.new authorized_keys`, pub)
+}
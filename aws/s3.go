@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// PutObject streams body into the bucket, multipart for large archives
+func PutObject(c *Client, bucket, key string, body io.Reader) error {
+	uploader := s3manager.NewUploader(c.Sess)
+	_, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	return err
+}
+
+func GetObject(c *Client, bucket, key string) (io.ReadCloser, error) {
+	output, err := s3.New(c.Sess).GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func ListObjectKeys(c *Client, bucket, prefix string) ([]string, error) {
+	var keys []string
+	err := s3.New(c.Sess).ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, *object.Key)
+		}
+		return true
+	})
+	return keys, err
+}
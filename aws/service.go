@@ -3,56 +3,153 @@ package aws
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"hub/logger"
+
+	"fx-tools/docker"
+	"fx-tools/inventory"
+)
+
+const (
+	MarketOnDemand = "on-demand"
+	MarketSpot     = "spot"
 )
 
+// InstanceOptions how the instance of a node is launched
+type InstanceOptions struct {
+	// Region the configured region when empty
+	Region       string
+	InstanceType string
+	DiskSize     string
+	Spot         bool
+	SpotMaxPrice string
+}
+
+// Instance a launched node instance, Market tells whether spot had capacity
+type Instance struct {
+	StackName    string
+	Region       string
+	InstanceType string
+	Arch         string
+	Market       string
+	PublicIP     string
+	PrivateIP    string
+	InstanceId   string
+	// PrivateKey the PEM ssh key authorized on the instance
+	PrivateKey string
+}
+
 func NewAwsEC2Instance(stackName, instanceType, diskSize string) (ip, privateIp string, err error) {
-	client, err := NewDefAWSClient()
+	return NewAwsEC2InstanceIn("", stackName, instanceType, diskSize)
+}
+
+// NewAwsEC2InstanceIn creates the stack in region, the configured region when empty
+func NewAwsEC2InstanceIn(region, stackName, instanceType, diskSize string) (ip, privateIp string, err error) {
+	instance, err := LaunchInstance(stackName, InstanceOptions{Region: region, InstanceType: instanceType, DiskSize: diskSize})
 	if err != nil {
-		logger.L.Errorf("new aws client error: %s", err.Error())
 		return
 	}
+	path, err := inventory.SaveKey("", stackName, instance.PublicIP, []byte(instance.PrivateKey))
+	if err != nil {
+		logger.L.Errorf("save ssh key of %s error: %s", stackName, err.Error())
+		return
+	}
+	logger.L.Infof("ssh key of %s: %s", stackName, path)
+	return instance.PublicIP, instance.PrivateIP, nil
+}
 
-	ip, privateIp, _, err = RunCFStack(client, stackName, instanceType, diskSize)
+// LaunchInstance creates the stack of a node, a spot instance without capacity or below
+// the spot price is replaced by an on-demand one
+func LaunchInstance(stackName string, opts InstanceOptions) (*Instance, error) {
+	client, err := NewRegionAWSClient(opts.Region)
+	if err != nil {
+		logger.L.Errorf("new aws client error: %s", err.Error())
+		return nil, err
+	}
+
+	instance, _, err := runStack(client, stackName, opts)
+	if err != nil && opts.Spot && spotUnavailable(err) {
+		logger.L.Warnf("stack %s spot unavailable, falling back to on-demand: %s", stackName, err.Error())
+		if err = DeleteCfStackAndWait(client, stackName); err != nil {
+			return nil, err
+		}
+		opts.Spot = false
+		instance, _, err = runStack(client, stackName, opts)
+	}
 	if err != nil {
 		logger.L.Errorf("run cf Stack error: %s", err.Error())
-		return
+		return nil, err
 	}
-	return
+	return instance, nil
 }
 
+// the spot failures of the stack events, any other failure is not retried on-demand
+var spotFailures = []string{
+	"InsufficientInstanceCapacity", "capacity-not-available", "SpotMaxPriceTooLow", "price-too-low",
+	"MaxSpotInstanceCountExceeded", "InsufficientCapacity",
+}
+
+func spotUnavailable(err error) bool {
+	for _, failure := range spotFailures {
+		if strings.Contains(err.Error(), failure) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunCFStack creates the stack of an on-demand instance and returns once its docker daemon is ready
 func RunCFStack(client *Client, stackName, instanceType, diskSize string) (publicIP, privateIP, priKey string, err error) {
+	instance, priKey, err := runStack(client, stackName, InstanceOptions{InstanceType: instanceType, DiskSize: diskSize})
+	if err != nil {
+		return
+	}
+	return instance.PublicIP, instance.PrivateIP, priKey, nil
+}
+
+// runStack creates the stack and returns once its docker daemon is ready, within the stack timeout
+func runStack(client *Client, stackName string, opts InstanceOptions) (instance *Instance, priKey string, err error) {
 	priKey, pubKey, err := GenSSHKey()
 	if err != nil {
 		return
 	}
 
-	err = CreateCfStack(client, stackName, instanceType, diskSize, pubKey)
+	err = CreateCfStack(client, stackName, pubKey, opts)
 	if err != nil {
 		return
 	}
 
-	var instanceId string
-	du := time.Duration(70)
-	for i := 0; i < 6; i++ {
-		time.Sleep(du * time.Second)
-		publicIP, privateIP, instanceId, err = GetCfStackIP(client, stackName)
-		if err != nil {
-			logger.L.Debugf("fetch instance publicIP: %s", err.Error())
-			du = 5
-			continue
-		}
-		break
+	start := time.Now()
+	if err = WaitStackCreate(client, stackName, client.stackTimeout); err != nil {
+		return
+	}
+	instance = &Instance{StackName: stackName, Region: client.Region, InstanceType: opts.InstanceType, Arch: InstanceArch(opts.InstanceType), Market: MarketOnDemand, PrivateKey: priKey}
+	if opts.Spot {
+		instance.Market = MarketSpot
+	}
+	instance.PublicIP, instance.PrivateIP, instance.InstanceId, err = GetCfStackIP(client, stackName)
+	if err != nil {
+		return
 	}
-	if publicIP == "" || instanceId == "" {
+	if instance.PublicIP == "" || instance.InstanceId == "" {
 		err = errors.New("failed to get ec2 instance publicIP")
 		return
 	}
-	if err = InstanceVolumeSetName(client, instanceId, stackName); err != nil {
+	if err = InstanceVolumeSetName(client, instance.InstanceId, stackName); err != nil {
+		return
+	}
+	// the daemon of the built-in template waits for its certificate
+	if client.stackTemplateRUL == "" {
+		if err = installServerCert(client.dockerCertPath, instance.PublicIP, instance.PrivateIP, []byte(priKey), client.stackTimeout-time.Since(start)); err != nil {
+			return
+		}
+	}
+	if err = docker.WaitReady(fmt.Sprintf("tcp://%s:2376", instance.PublicIP), client.stackTimeout-time.Since(start)); err != nil {
 		return
 	}
+	logger.L.Infof("stack %s ready in %s, publicIP: %s, %s %s", stackName, time.Since(start).Round(time.Second), instance.PublicIP, instance.Market, instance.InstanceType)
 	return
 }
 
@@ -0,0 +1,86 @@
+package aws
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fx-tools/inventory"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHUser the user of the image, the stack user data authorizes the generated key for it
+const SSHUser = "ubuntu"
+
+// KnownHostsFile the host keys trusted on first use, shared by every network
+var KnownHostsFile = filepath.Join(inventory.Dir, "known_hosts")
+
+var knownHostsMu sync.Mutex
+
+// trustOnFirstUse accepts and records the key of an unknown host, and rejects a host whose key changed
+func trustOnFirstUse(path string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// reloaded on every dial, hosts recorded by the other connections are known
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return err
+		}
+		err = callback(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key of %s changed, remove it from %s if the instance was replaced: %s", hostname, path, err.Error())
+		}
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}
+}
+
+// DialSSH connects to ip:22 as SSHUser with the PEM private key, trusting the host key on first use
+func DialSSH(ip string, key []byte) (*ssh.Client, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, 22), &ssh.ClientConfig{
+		User:            SSHUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: trustOnFirstUse(KnownHostsFile),
+		Timeout:         10 * time.Second,
+	})
+}
+
+// RunSSH runs command on the connected host with stdin, when not nil, and returns its output
+func RunSSH(client *ssh.Client, command string, stdin io.Reader) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdin, session.Stdout, session.Stderr = stdin, &stdout, &stderr
+	if err = session.Run(command); err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
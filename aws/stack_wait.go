@@ -0,0 +1,89 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hub/logger"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// DefStackTimeout how long a stack and its docker daemon may take when stack_timeout is not set
+const DefStackTimeout = 15 * time.Minute
+
+const stackEventInterval = 5 * time.Second
+
+// stackEvents the events of the stack not in seen, oldest first
+func stackEvents(c *Client, stackName string, seen map[string]bool) ([]*cloudformation.StackEvent, error) {
+	var events []*cloudformation.StackEvent
+	err := cloudformation.New(c.Sess).DescribeStackEventsPages(&cloudformation.DescribeStackEventsInput{StackName: aws.String(stackName)},
+		func(page *cloudformation.DescribeStackEventsOutput, _ bool) bool {
+			for _, event := range page.StackEvents {
+				id := aws.StringValue(event.EventId)
+				if seen[id] {
+					// the events come newest first, the rest has been seen already
+					return false
+				}
+				seen[id] = true
+				events = append(events, event)
+			}
+			return true
+		})
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.TimeValue(events[i].Timestamp).Before(aws.TimeValue(events[j].Timestamp))
+	})
+	return events, err
+}
+
+// stackFailure the first failed resource and its reason
+func stackFailure(events []*cloudformation.StackEvent) string {
+	for _, event := range events {
+		if strings.HasSuffix(aws.StringValue(event.ResourceStatus), "_FAILED") && aws.StringValue(event.ResourceType) != "AWS::CloudFormation::Stack" {
+			return fmt.Sprintf("%s (%s) %s: %s", aws.StringValue(event.LogicalResourceId), aws.StringValue(event.ResourceType),
+				aws.StringValue(event.ResourceStatus), aws.StringValue(event.ResourceStatusReason))
+		}
+	}
+	for _, event := range events {
+		if reason := aws.StringValue(event.ResourceStatusReason); reason != "" && strings.Contains(aws.StringValue(event.ResourceStatus), "FAILED") {
+			return reason
+		}
+	}
+	return "no failure reason in the stack events"
+}
+
+// WaitStackCreate follows the stack events until the stack is created, logging every resource change.
+// A rolled back or failed stack returns the resource that failed and why
+func WaitStackCreate(c *Client, stackName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	seen := make(map[string]bool)
+	var history []*cloudformation.StackEvent
+	for {
+		events, err := stackEvents(c, stackName, seen)
+		if err != nil {
+			return err
+		}
+		history = append(history, events...)
+		for _, event := range events {
+			logger.L.Infof("stack %s: %s %s %s", stackName, aws.StringValue(event.LogicalResourceId),
+				aws.StringValue(event.ResourceStatus), aws.StringValue(event.ResourceStatusReason))
+			if aws.StringValue(event.ResourceType) != "AWS::CloudFormation::Stack" {
+				continue
+			}
+			switch status := aws.StringValue(event.ResourceStatus); status {
+			case cloudformation.StackStatusCreateComplete:
+				return nil
+			case cloudformation.StackStatusCreateFailed, cloudformation.StackStatusRollbackInProgress,
+				cloudformation.StackStatusRollbackComplete, cloudformation.StackStatusRollbackFailed:
+				return fmt.Errorf("stack %s %s: %s", stackName, status, stackFailure(history))
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("stack %s not created after %s", stackName, timeout)
+		}
+		time.Sleep(stackEventInterval)
+	}
+}
@@ -0,0 +1,296 @@
+package aws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TemplateVersion is tagged on every stack, bump it with any change of the rendered template
+const TemplateVersion = "2"
+
+// the outputs GetCfStackIP reads
+const (
+	OutputServerIP     = "ServerIP"
+	OutputServerID     = "ServerID"
+	OutputPrivateIp    = "PrivateIp"
+	OutputServerPubDns = "ServerPubDns"
+)
+
+// DefImage the public SSM parameter of the latest ubuntu 20.04 image of an architecture, resolved in every region
+const DefImage = "/aws/service/canonical/ubuntu/server/20.04/stable/current/%s/hvm/ebs-gp2/ami-id"
+
+const (
+	ArchAmd64 = "amd64"
+	ArchArm64 = "arm64"
+)
+
+var gravitonFamily = regexp.MustCompile(`^(a1|[a-z]+[0-9]+g[a-z]*)\.`)
+
+// InstanceArch arm64 for the Graviton instance types, amd64 otherwise
+func InstanceArch(instanceType string) string {
+	if gravitonFamily.MatchString(instanceType) {
+		return ArchArm64
+	}
+	return ArchAmd64
+}
+
+// TemplateParams what is rendered into the template, the per stack values are CloudFormation parameters
+type TemplateParams struct {
+	// AMI an image id, or an SSM parameter holding one, DefImage of Arch when empty
+	AMI  string
+	Arch string
+	// VpcId and SubnetId are regional, leave them empty for the default VPC
+	VpcId    string
+	SubnetId string
+	// AllowedCIDRs may reach ssh, docker, rpc and the monitoring ports, p2p is open to everyone
+	AllowedCIDRs []string
+	DiskType     string
+	DiskIops     int64
+	// Spot launches a one-time spot instance, SpotMaxPrice empty caps it at the on-demand price
+	Spot         bool
+	SpotMaxPrice string
+}
+
+var templatePorts = []int64{22, 2376, 26657, 26660, 26680, 9090, 9100, 3000}
+
+type cfn map[string]interface{}
+
+func ref(name string) cfn {
+	return cfn{"Ref": name}
+}
+
+func getAtt(resource, attribute string) cfn {
+	return cfn{"Fn::GetAtt": []string{resource, attribute}}
+}
+
+func sub(s string) cfn {
+	return cfn{"Fn::Sub": s}
+}
+
+// the docker daemon listens on 2376 and only accepts the clients of the CA. Its key is made on the host,
+// dockerd restarts with TLS once installServerCert puts the certificate the CA signed next to it.
+// node-exporter serves the host metrics on 9100
+const userData = `#!/bin/bash -xe
+mkdir -p /home/ubuntu/.ssh /etc/docker/certs /etc/systemd/system/docker.service.d
+echo "${SSHKEY}" >> /home/ubuntu/.ssh/authorized_keys
+chown -R ubuntu:ubuntu /home/ubuntu/.ssh
+curl -fsSL https://get.docker.com | sh
+usermod -aG docker ubuntu
+docker run -d --name node-exporter --restart unless-stopped --net host --pid host -v /:/host:ro,rslave prom/node-exporter --path.rootfs=/host
+cd /etc/docker/certs
+cat > ca.pem <<'EOF'
+${DockerCACert}
+EOF
+(umask 077; openssl ecparam -name prime256v1 -genkey -noout -out server-key.pem)
+openssl req -new -key server-key.pem -subj /CN=${AWS::StackName} -out server.csr.new
+mv server.csr.new server.csr
+until [ -s server-cert.pem ]; do sleep 2; done
+cat > /etc/systemd/system/docker.service.d/tls.conf <<'EOF'
+[Service]
+ExecStart=
+ExecStart=/usr/bin/dockerd -H unix:///var/run/docker.sock -H tcp://0.0.0.0:2376 --tlsverify --tlscacert=/etc/docker/certs/ca.pem --tlscert=/etc/docker/certs/server-cert.pem --tlskey=/etc/docker/certs/server-key.pem
+EOF
+systemctl daemon-reload
+systemctl restart docker
+`
+
+// RenderTemplate the CloudFormation template of one chain node
+func RenderTemplate(params TemplateParams) ([]byte, error) {
+	if len(params.AllowedCIDRs) == 0 {
+		return nil, errors.New("no allowed cidr, set allowed_cidrs in the [aws] config")
+	}
+	diskType := params.DiskType
+	if diskType == "" {
+		diskType = "gp2"
+	}
+	arch := params.Arch
+	if arch == "" {
+		arch = ArchAmd64
+	}
+	image := params.AMI
+	if image == "" {
+		image = fmt.Sprintf(DefImage, arch)
+	}
+	imageType := "AWS::SSM::Parameter::Value<AWS::EC2::Image::Id>"
+	if strings.HasPrefix(image, "ami-") {
+		imageType = "AWS::EC2::Image::Id"
+	}
+
+	parameters := cfn{
+		"InstanceType": cfn{"Type": "String", "Default": "c5.xlarge"},
+		"DiskSize":     cfn{"Type": "Number", "Default": 40},
+		"SSHKEY":       cfn{"Type": "String", "Description": "public key appended to the authorized keys of ubuntu"},
+		"ImageId":      cfn{"Type": imageType, "Default": image},
+		"DockerCACert": cfn{"Type": "String", "Description": "CA of the docker clients and of the daemon certificate"},
+	}
+
+	var ingress []cfn
+	ingress = append(ingress, cfn{"IpProtocol": "tcp", "FromPort": 26656, "ToPort": 26656, "CidrIp": "0.0.0.0/0"})
+	for _, cidr := range params.AllowedCIDRs {
+		for _, port := range templatePorts {
+			ingress = append(ingress, cfn{"IpProtocol": "tcp", "FromPort": port, "ToPort": port, "CidrIp": cidr})
+		}
+	}
+	securityGroup := cfn{
+		"GroupDescription":     sub("fx chain node ${AWS::StackName}"),
+		"SecurityGroupIngress": ingress,
+	}
+	if params.VpcId != "" {
+		securityGroup["VpcId"] = params.VpcId
+	}
+
+	ebs := cfn{"VolumeSize": ref("DiskSize"), "VolumeType": diskType, "DeleteOnTermination": true}
+	if params.DiskIops > 0 {
+		ebs["Iops"] = params.DiskIops
+	}
+	instance := cfn{
+		"InstanceType":        ref("InstanceType"),
+		"ImageId":             ref("ImageId"),
+		"BlockDeviceMappings": []cfn{{"DeviceName": "/dev/sda1", "Ebs": ebs}},
+		"UserData":            cfn{"Fn::Base64": sub(userData)},
+		"Tags":                []cfn{{"Key": "Name", "Value": ref("AWS::StackName")}},
+	}
+	if params.SubnetId != "" {
+		// a subnet needs an explicit public address and group ids
+		instance["NetworkInterfaces"] = []cfn{{
+			"DeviceIndex":              "0",
+			"SubnetId":                 params.SubnetId,
+			"AssociatePublicIpAddress": true,
+			"GroupSet":                 []cfn{getAtt("SecurityGroup", "GroupId")},
+		}}
+	} else {
+		instance["SecurityGroupIds"] = []cfn{getAtt("SecurityGroup", "GroupId")}
+	}
+
+	resources := cfn{
+		"SecurityGroup": cfn{"Type": "AWS::EC2::SecurityGroup", "Properties": securityGroup},
+		"Instance":      cfn{"Type": "AWS::EC2::Instance", "Properties": instance},
+	}
+	if params.Spot {
+		spotOptions := cfn{"SpotInstanceType": "one-time", "InstanceInterruptionBehavior": "terminate"}
+		if params.SpotMaxPrice != "" {
+			spotOptions["MaxPrice"] = params.SpotMaxPrice
+		}
+		resources["SpotLaunchTemplate"] = cfn{
+			"Type": "AWS::EC2::LaunchTemplate",
+			"Properties": cfn{"LaunchTemplateData": cfn{
+				"InstanceMarketOptions": cfn{"MarketType": "spot", "SpotOptions": spotOptions},
+			}},
+		}
+		instance["LaunchTemplate"] = cfn{
+			"LaunchTemplateId": ref("SpotLaunchTemplate"),
+			"Version":          getAtt("SpotLaunchTemplate", "LatestVersionNumber"),
+		}
+	}
+
+	template := cfn{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              fmt.Sprintf("fx chain node, template version %s", TemplateVersion),
+		"Parameters":               parameters,
+		"Resources":                resources,
+		"Outputs": cfn{
+			OutputServerIP:     cfn{"Value": getAtt("Instance", "PublicIp")},
+			OutputServerID:     cfn{"Value": ref("Instance")},
+			OutputPrivateIp:    cfn{"Value": getAtt("Instance", "PrivateIp")},
+			OutputServerPubDns: cfn{"Value": getAtt("Instance", "PublicDnsName")},
+			"TemplateVersion":  cfn{"Value": TemplateVersion},
+		},
+	}
+	return json.MarshalIndent(template, "", "  ")
+}
+
+var pseudoParameters = map[string]bool{
+	"AWS::AccountId": true, "AWS::NotificationARNs": true, "AWS::NoValue": true, "AWS::Partition": true,
+	"AWS::Region": true, "AWS::StackId": true, "AWS::StackName": true, "AWS::URLSuffix": true,
+}
+
+var subVariable = regexp.MustCompile(`\$\{([^!}][^}]*)}`)
+
+// ValidateTemplate checks a template offline: the sections, the resource types, every Ref,
+// Fn::GetAtt and Fn::Sub variable, and the outputs GetCfStackIP depends on
+func ValidateTemplate(body []byte) error {
+	var template struct {
+		AWSTemplateFormatVersion string
+		Parameters               map[string]json.RawMessage
+		Resources                map[string]struct {
+			Type       string
+			Properties interface{}
+		}
+		Outputs map[string]struct {
+			Value interface{}
+		}
+	}
+	if err := json.Unmarshal(body, &template); err != nil {
+		return err
+	}
+	if template.AWSTemplateFormatVersion != "2010-09-09" {
+		return fmt.Errorf("unknown AWSTemplateFormatVersion %q", template.AWSTemplateFormatVersion)
+	}
+	if len(template.Resources) == 0 {
+		return errors.New("template has no resources")
+	}
+
+	var problems []string
+	known := func(name string) bool {
+		_, isParameter := template.Parameters[name]
+		_, isResource := template.Resources[name]
+		return isParameter || isResource || pseudoParameters[name]
+	}
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				switch key {
+				case "Ref":
+					if name, _ := value.(string); !known(name) {
+						problems = append(problems, fmt.Sprintf("%s: unknown Ref %v", path, value))
+					}
+				case "Fn::GetAtt":
+					if att, _ := value.([]interface{}); len(att) != 2 {
+						problems = append(problems, fmt.Sprintf("%s: Fn::GetAtt needs a resource and an attribute", path))
+					} else if name, _ := att[0].(string); template.Resources[name].Type == "" {
+						problems = append(problems, fmt.Sprintf("%s: Fn::GetAtt of unknown resource %v", path, att[0]))
+					}
+				case "Fn::Sub":
+					if s, ok := value.(string); ok {
+						for _, match := range subVariable.FindAllStringSubmatch(s, -1) {
+							name := strings.SplitN(match[1], ".", 2)[0]
+							if !known(name) {
+								problems = append(problems, fmt.Sprintf("%s: unknown Fn::Sub variable %s", path, match[1]))
+							}
+						}
+					}
+				}
+				walk(path+"."+key, value)
+			}
+		case []interface{}:
+			for i, value := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), value)
+			}
+		}
+	}
+	for name, resource := range template.Resources {
+		if !strings.Contains(resource.Type, "::") {
+			problems = append(problems, fmt.Sprintf("resource %s: invalid type %q", name, resource.Type))
+		}
+		walk(name, resource.Properties)
+	}
+	for name, output := range template.Outputs {
+		walk("Outputs."+name, output.Value)
+	}
+	for _, name := range []string{OutputServerIP, OutputServerID, OutputPrivateIp, OutputServerPubDns} {
+		if _, ok := template.Outputs[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing output %s", name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package aws
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"fx-tools/docker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	body, err := RenderTemplate(TemplateParams{AllowedCIDRs: []string{"10.0.0.0/8"}, SubnetId: "subnet-1", VpcId: "vpc-1", DiskType: "io1", DiskIops: 3000})
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateTemplate(body))
+
+	var template struct {
+		Outputs map[string]interface{}
+	}
+	assert.NoError(t, json.Unmarshal(body, &template))
+	// GetCfStackIP reads these
+	for _, key := range []string{"ServerIP", "ServerID", "PrivateIp", "ServerPubDns"} {
+		assert.Contains(t, template.Outputs, key)
+	}
+
+	// the daemon key is made on the host and clients are always verified
+	assert.Contains(t, string(body), "--tlsverify")
+	assert.Contains(t, string(body), "server.csr")
+	assert.NotContains(t, string(body), "DockerServerKey")
+
+	_, err = RenderTemplate(TemplateParams{})
+	assert.Error(t, err)
+
+	body, err = RenderTemplate(TemplateParams{AllowedCIDRs: []string{"10.0.0.0/8"}, Arch: ArchArm64, Spot: true, SpotMaxPrice: "0.05"})
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateTemplate(body))
+	assert.Contains(t, string(body), "SpotLaunchTemplate")
+	assert.Contains(t, string(body), "/current/arm64/")
+}
+
+func TestInstanceArch(t *testing.T) {
+	assert.Equal(t, ArchAmd64, InstanceArch("c5.xlarge"))
+	assert.Equal(t, ArchAmd64, InstanceArch("g4dn.xlarge"))
+	assert.Equal(t, ArchArm64, InstanceArch("c6g.xlarge"))
+	assert.Equal(t, ArchArm64, InstanceArch("m6gd.large"))
+	assert.Equal(t, ArchArm64, InstanceArch("t4g.micro"))
+	assert.Equal(t, ArchArm64, InstanceArch("a1.large"))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	body := []byte(`{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Resources": {"Instance": {"Type": "AWS::EC2::Instance", "Properties": {"ImageId": {"Ref": "Image"}}}},
+		"Outputs": {"ServerIP": {"Value": {"Fn::GetAtt": ["Server", "PublicIp"]}}}
+	}`)
+	err := ValidateTemplate(body)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown Ref Image")
+	assert.Contains(t, err.Error(), "unknown resource Server")
+	assert.Contains(t, err.Error(), "missing output ServerID")
+}
+
+func TestDockerCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fx-certs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, err = dockerCA(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "fx docker certs gen")
+
+	_, err = docker.GenerateCerts(dir, docker.CertOptions{Days: 1})
+	assert.NoError(t, err)
+	ca, err := dockerCA(dir)
+	assert.NoError(t, err)
+	assert.Contains(t, ca, "BEGIN CERTIFICATE")
+}
@@ -0,0 +1,116 @@
+package aws
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"hub/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// WriteMetricSeries renders the series as a table, csv with one row per data point, or json
+func WriteMetricSeries(w io.Writer, series []MetricSeries, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(series, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"stack", "instance_id", "volume_id", "metric", "stat", "unit", "timestamp", "value"}); err != nil {
+			return err
+		}
+		for _, s := range series {
+			for i, timestamp := range s.Timestamps {
+				if err := cw.Write([]string{s.Stack, s.InstanceId, s.VolumeId, s.Metric, s.Stat, s.Unit,
+					timestamp.UTC().Format(time.RFC3339), strconv.FormatFloat(s.Values[i], 'f', -1, 64)}); err != nil {
+					return err
+				}
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "STACK\tINSTANCE\tVOLUME\tMETRIC\tSTAT\tUNIT\tPOINTS\tLATEST\tAVG\tMAX")
+		for _, s := range series {
+			latest := "-"
+			if v, ok := s.Latest(); ok {
+				latest = strconv.FormatFloat(v, 'f', 2, 64)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%.2f\t%.2f\n",
+				s.Stack, s.InstanceId, s.VolumeId, s.Metric, s.Stat, s.Unit, len(s.Values), latest, s.Average(), s.Max())
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output: %s", output)
+	}
+}
+
+// ServeInstanceStatistics polls the latest CloudWatch values of the instances, stack name or instance id,
+// every interval and serves them as prometheus gauges on listen
+func ServeInstanceStatistics(c *Client, instances []string, listen string, interval time.Duration, periodSeconds int64) error {
+	if err := CheckPeriod(time.Duration(periodSeconds) * time.Second); err != nil {
+		return err
+	}
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "fx",
+		Subsystem: "aws",
+		Name:      "cloudwatch",
+		Help:      "latest CloudWatch value of an instance or volume metric",
+	}, []string{"stack", "instance_id", "volume_id", "metric", "stat", "unit"})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(gauge)
+
+	// listen before polling, a port in use fails right away
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{MaxRequestsInFlight: 3})}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.L.Infof("cloudwatch exporter running on %s", listen)
+		serveErr <- srv.Serve(listener)
+	}()
+	defer srv.Close()
+
+	for {
+		for _, nameOrId := range instances {
+			instanceId, stack, err := ResolveInstanceId(c, nameOrId)
+			if err != nil {
+				logger.L.Warnf("%s: %s", nameOrId, err.Error())
+				continue
+			}
+			// CloudWatch publishes with a delay, look back a few periods for the latest point
+			end := time.Now()
+			series, err := GetInstanceStatistics(c, instanceId, end.Add(-3*time.Duration(periodSeconds)*time.Second), end, periodSeconds)
+			if err != nil {
+				logger.L.Warnf("%s: %s", nameOrId, err.Error())
+				continue
+			}
+			for _, s := range series {
+				if v, ok := s.Latest(); ok {
+					gauge.WithLabelValues(stack, s.InstanceId, s.VolumeId, s.Metric, s.Stat, s.Unit).Set(v)
+				}
+			}
+		}
+		select {
+		case err := <-serveErr:
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
@@ -10,10 +10,19 @@ import (
 )
 
 type Config struct {
-	NodeNumber         int    `mapstructure:"node_number"`
-	InstanceType       string `mapstructure:"instance_type"`
-	DiskSize           string `mapstructure:"disk_size"`
-	Delegate           string `mapstructure:"delegate"`
+	NodeNumber         int      `mapstructure:"node_number"`
+	InstanceType       string   `mapstructure:"instance_type"`
+	DiskSize           string   `mapstructure:"disk_size"`
+	Delegate           string   `mapstructure:"delegate"`
+	SeedSecret         string   `mapstructure:"seed_secret"`
+	SeedIP             string   `mapstructure:"seed_ip"`
+	SeedInstanceType   string   `mapstructure:"seed_instance_type"`
+	SentryNumber       int      `mapstructure:"sentry_number"`
+	Regions            []string `mapstructure:"regions"`
+	InstanceTypes      []string `mapstructure:"instance_types"`
+	Spot               bool     `mapstructure:"spot"`
+	SpotMaxPrice       string   `mapstructure:"spot_max_price"`
+	Network            string   `mapstructure:"network"`
 	common.ChainConfig `mapstructure:",squash"`
 }
 
@@ -3,6 +3,8 @@ package chain
 import (
 	"time"
 
+	"fx-tools/inventory"
+
 	"github.com/spf13/cobra"
 )
 
@@ -20,11 +22,18 @@ func NewDeployChainCmd() *cobra.Command {
 	cmd.PersistentFlags().String("token", "", "")
 	cmd.PersistentFlags().String("address_prefix", "", "")
 	cmd.PersistentFlags().Duration("block_time", 5*time.Second, "")
-	cmd.PersistentFlags().String("config.p2p.seeds", "", "")
+	cmd.PersistentFlags().String("config.p2p.seeds", "", "id@ip:26656, a seed node is deployed when neither this nor --seed_ip is set")
 	cmd.PersistentFlags().Uint("config.p2p.max_packet_msg_payload_size", 1, "")
 	cmd.PersistentFlags().Uint64("p2p.send_rate", 6, "/")
 	cmd.PersistentFlags().Uint64("p2p.recv_rate", 5, "/")
-	cmd.MarkFlagRequired("seed")
+	cmd.PersistentFlags().String("seed_secret", "functionx", "node key secret of the seed, its id is derived from it")
+	cmd.PersistentFlags().String("seed_ip", "", "use the seed already running on this ip instead of deploying one")
+	cmd.PersistentFlags().String("seed_instance_type", "t3.medium", "")
+	cmd.PersistentFlags().StringSlice("regions", nil, "aws regions the nodes are spread over, nodes then peer over public IPs")
+	cmd.PersistentFlags().String("network", inventory.DefKeyNetwork, "record the deployed nodes and their ssh keys in this inventory network")
+	cmd.PersistentFlags().StringSlice("instance_types", nil, "role=type, e.g. validator=c6g.xlarge,normal=t3.large, Graviton types get an arm64 image")
+	cmd.PersistentFlags().Bool("spot", false, "launch spot instances, on-demand ones when spot has no capacity")
+	cmd.PersistentFlags().String("spot_max_price", "", "hourly spot price cap, the on-demand price when empty")
 
 	cmd.AddCommand(
 		NewDeployValidatorNodeCmd(),
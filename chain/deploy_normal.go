@@ -10,6 +10,7 @@ import (
 
 	"fx-tools/aws"
 	"fx-tools/docker"
+	"fx-tools/inventory"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,47 +19,60 @@ import (
 func NewDeployNormalNodeCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "normal",
-		Example: "fx deploy normal --seed [] --ip <> --num 4",
-		Run: func(*cobra.Command, []string) {
-			DeployMultiNormalNode()
+		Example: "fx deploy normal --seed_ip <> --ip <> --node_number 4",
+		RunE: func(*cobra.Command, []string) error {
+			return DeployMultiNormalNode()
 		},
 	}
 	cmd.Flags().String("ip", "", "")
 	return cmd
 }
 
-func DeployMultiNormalNode() {
+func DeployMultiNormalNode() error {
 	cfg := GetConfig()
+	if err := cfg.checkRegions(); err != nil {
+		return err
+	}
 	valIp := viper.GetString("ip")
+	if err := resolveSeeds(&cfg, false); err != nil {
+		return err
+	}
 
 	wg := sync.WaitGroup{}
-	maxParallelChan := make(chan struct{}, 20)
+	limits := regionLimits(cfg.Regions, 20)
 	for i := 0; i < cfg.NodeNumber; i++ {
 		wg.Add(1)
-		maxParallelChan <- struct{}{}
+		region := cfg.regionOf(i)
 
 		stackName := fmt.Sprintf("fx-chain-%s-normal-%d-%d", os.ExpandEnv("$USER"), i, time.Now().UnixNano()/1000)
 		cfg.NodeName = fmt.Sprintf("%s-normal-%d", cfg.NodeName, i)
 
-		go func(cfgStr string, valIP, stackName string) {
+		go func(cfgStr string, valIP, stackName string, i int) {
 			defer wg.Done()
-			defer func() { <-maxParallelChan }()
+			// waited for in the goroutine, a busy region does not hold back the others
+			limits[region] <- struct{}{}
+			defer func() { <-limits[region] }()
 
 			var cfg Config
 			(&cfg).JsonUnmarshal(cfgStr)
 
-			ip, privateIp, err := aws.NewAwsEC2Instance(stackName, cfg.InstanceType, cfg.DiskSize)
+			instance, err := aws.LaunchInstance(stackName, cfg.instanceOptions(inventory.RoleNormal, i))
 			if err != nil {
 				logger.L.Errorf("new aws ec2 instance error: %s", err.Error())
 				return
 			}
+			ip, privateIp := instance.PublicIP, instance.PrivateIP
 
-			cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", privateIp)
+			cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", cfg.p2pIP(ip, privateIp))
 			if err := docker.StartChain(ip, append([]string{"normal"}, cfg.ChainConfig.String(), fmt.Sprintf("http://%s:26657", valIP))); err != nil {
 				logger.L.Errorf("docker start chain error: %s", err.Error())
 				return
 			}
-		}(cfg.JsonMarshal(), valIp, stackName)
+			fmt.Printf("node: http://%s:26657, name: %s, publicIP: %s, privateIP: %s, region: %s, instanceType: %s, market: %s\n",
+				ip, stackName, ip, privateIp, instance.Region, instance.InstanceType, instance.Market)
+			recordNode(cfg.Network, withNodeID(nodeOf(instance, inventory.RoleNormal)), instance.PrivateKey)
+		}(cfg.JsonMarshal(), valIp, stackName, i)
 	}
 	wg.Wait()
+	return nil
 }
@@ -13,6 +13,7 @@ import (
 
 	"fx-tools/aws"
 	"fx-tools/docker"
+	"fx-tools/inventory"
 
 	"github.com/spf13/cobra"
 )
@@ -20,11 +21,12 @@ import (
 func NewDeployValidatorNodeCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "validator",
-		Example: "fx deploy validator --seed  --node_number 4",
+		Example: "fx deploy validator --node_number 4 --sentry_number 2 --regions us-east-2,eu-west-1,ap-northeast-1 --network wan",
 		RunE: func(*cobra.Command, []string) (err error) {
 			return DeployMultiValidatorNode()
 		},
 	}
+	cmd.Flags().Uint("sentry_number", 0, "sentry nodes per validator, validators then only peer with their sentries")
 	return cmd
 }
 
@@ -32,32 +34,46 @@ func DeployMultiValidatorNode() (err error) {
 
 	cdc := app.MakeCodec()
 	cfg := GetConfig()
+	if err = cfg.checkRegions(); err != nil {
+		return err
+	}
 
 	if err = (&cfg.ChainConfig).AddValidators(cdc, cfg.NodeNumber, fmt.Sprintf("%s%s", cfg.Delegate, cfg.ChainConfig.Token)); err != nil {
 		return err
 	}
+	if err = resolveSeeds(&cfg, true); err != nil {
+		return err
+	}
 
 	wg := sync.WaitGroup{}
-	maxParallelChan := make(chan struct{}, 20)
+	limits := regionLimits(cfg.Regions, 20)
 	for i, acc := range cfg.PresetAccounts {
 		wg.Add(1)
-		maxParallelChan <- struct{}{}
+		region := cfg.regionOf(i)
 		stackName := fmt.Sprintf("fx-chain-%s-validator-%d-%d", os.ExpandEnv("$USER"), i, time.Now().UnixNano()/1000)
 
-		go func(cfgStr string, acc common.Account) {
+		go func(cfgStr string, i int, acc common.Account) {
 			defer wg.Done()
-			defer func() { <-maxParallelChan }()
+			// waited for in the goroutine, a busy region does not hold back the others
+			limits[region] <- struct{}{}
+			defer func() { <-limits[region] }()
 
 			var cfg Config
 			(&cfg).JsonUnmarshal(cfgStr)
 
-			publicIP, privateIP, err := aws.NewAwsEC2Instance(stackName, cfg.InstanceType, cfg.DiskSize)
+			instance, err := aws.LaunchInstance(stackName, cfg.instanceOptions(inventory.RoleValidator, i))
 			if err != nil {
 				logger.L.Errorf("new aws ec2 instance error: %s", err.Error())
 				return
 			}
+			publicIP, privateIP := instance.PublicIP, instance.PrivateIP
 
-			cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", privateIP)
+			cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", cfg.p2pIP(publicIP, privateIP))
+			if cfg.SentryNumber > 0 {
+				// the sentries dial the validator, nobody else learns its address
+				cfg.P2P.PexReactor = false
+				cfg.P2P.Seeds = ""
+			}
 			cfg.ValidatorPriKey = acc.NodeKey
 			chainCfg, err := cfg.ChainConfig.GenDockerInitCfg(cdc, app.ModuleBasics)
 			if err != nil {
@@ -68,9 +84,17 @@ func DeployMultiValidatorNode() (err error) {
 				logger.L.Errorf("docker start chain error: %s", err.Error())
 				return
 			}
-			fmt.Printf("node: http://%s:26657, name: %s, publicIP: %s, privateIP: %s, instanceType: %s, diskSize: %s\n", publicIP, stackName, publicIP, privateIP, cfg.InstanceType, cfg.DiskSize)
+			fmt.Printf("node: http://%s:26657, name: %s, publicIP: %s, privateIP: %s, region: %s, instanceType: %s, market: %s, diskSize: %s\n",
+				publicIP, stackName, publicIP, privateIP, instance.Region, instance.InstanceType, instance.Market, cfg.DiskSize)
+			recordNode(cfg.Network, withNodeID(nodeOf(instance, inventory.RoleValidator)), instance.PrivateKey)
 			fmt.Printf("nohup fx batch --ip %s --root %s --parallel 200 --times 15000 --debug > ~/node2/%s.log 2>&1 &\n", privateIP, acc.Key, privateIP)
-		}(cfg.JsonMarshal(), acc)
+
+			if cfg.SentryNumber > 0 {
+				if _, err := DeploySentryNodes(cfgStr, region, publicIP, privateIP, cfg.SentryNumber, i); err != nil {
+					logger.L.Errorf("deploy sentry nodes error: %s", err.Error())
+				}
+			}
+		}(cfg.JsonMarshal(), i, acc)
 	}
 	wg.Wait()
 	return nil
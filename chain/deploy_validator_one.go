@@ -10,6 +10,7 @@ import (
 
 	"fx-tools/aws"
 	"fx-tools/docker"
+	"fx-tools/inventory"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -35,14 +36,19 @@ func DeployOneValidatorNode() (err error) {
 	if err := (&cfg.ChainConfig).AddValidators(cdc, 1, fmt.Sprintf("%s%s", cfg.Delegate, cfg.ChainConfig.Token)); err != nil {
 		return err
 	}
+	if err := resolveSeeds(&cfg, false); err != nil {
+		return err
+	}
 
 	stackName := fmt.Sprintf("fx-chain-%s-%s-%d", os.ExpandEnv("$USER"), "one", time.Now().UnixNano()/1000)
 
-	publicIP, privateIP, err := aws.NewAwsEC2Instance(stackName, cfg.InstanceType, cfg.DiskSize)
+	instance, err := aws.LaunchInstance(stackName, cfg.instanceOptions(inventory.RoleValidator, 0))
 	if err != nil {
 		logger.L.Errorf("new aws ec2 instance error: %s", err.Error())
 		return
 	}
+	publicIP, privateIP := instance.PublicIP, instance.PrivateIP
+	recordNode(cfg.Network, nodeOf(instance, inventory.RoleValidator), instance.PrivateKey)
 
 	cfg.ChainConfig.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", privateIP)
 	cfg.ValidatorPriKey = cfg.PresetAccounts[0].NodeKey
@@ -55,6 +61,8 @@ func DeployOneValidatorNode() (err error) {
 		logger.L.Errorf("docker start chain error: %s", err.Error())
 		return
 	}
+	// recorded again once started, with its node id
+	recordNode(cfg.Network, withNodeID(nodeOf(instance, inventory.RoleValidator)), instance.PrivateKey)
 	logger.L.Infof("name: %s, publicIP: %s, privateIP: %s, node: http://%s:26657", stackName, publicIP, privateIP, publicIP)
 	logger.L.Infof("nohup fx push --ip %s --root %s --power 10 --times 50 --debug > /tmp/%s.log 2>&1 &", privateIP, cfg.PresetAccounts[0].Key, privateIP)
 
@@ -64,6 +72,11 @@ func DeployOneValidatorNode() (err error) {
 			return
 		}
 		logger.L.Infof("deploy success to prometheus: http://%s:9090", publicIP)
+		if err = docker.StartGrafana(publicIP, "http://127.0.0.1:9090"); err != nil {
+			logger.L.Errorf("docker start grafana error: %s", err.Error())
+			return
+		}
+		logger.L.Infof("grafana: http://%s:3000", publicIP)
 	}
 	return nil
 }
@@ -10,8 +10,6 @@ import (
 
 	"fx-tools/aws"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
-
 	"hub/app"
 	"hub/logger"
 
@@ -37,6 +35,7 @@ func NewChainCmd() *cobra.Command {
 		NewChainResetCmd(),
 		NewChainDeployCmd(),
 		NewChainGasPriceUpdateCmd(),
+		NewChainSnapshotCmd(),
 	)
 	return chainCmd
 }
@@ -101,13 +100,7 @@ func NewChainStopAllCmd() *cobra.Command {
 		Use:     "stop-all",
 		Example: "fx chain stop-all",
 		RunE: func(*cobra.Command, []string) (err error) {
-			stackTemplateRUL := ""
-			client, err := aws.NewAWSClient("us-east-1", stackTemplateRUL, credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     "",
-					SecretAccessKey: "",
-				},
-			})
+			client, err := aws.NewDefAWSClient()
 			if err != nil {
 				return err
 			}
@@ -153,13 +146,7 @@ func NewChainStartAllCmd() *cobra.Command {
 		Use:     "start-all",
 		Example: "fx chain start-all",
 		RunE: func(*cobra.Command, []string) (err error) {
-			stackTemplateRUL := ""
-			client, err := aws.NewAWSClient("us-east-1", stackTemplateRUL, credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     "",
-					SecretAccessKey: "",
-				},
-			})
+			client, err := aws.NewDefAWSClient()
 			if err != nil {
 				return err
 			}
@@ -219,13 +206,7 @@ func NewChainStatusAllCmd() *cobra.Command {
 		Use:     "status",
 		Example: "fx chain status",
 		RunE: func(*cobra.Command, []string) (err error) {
-			stackTemplateRUL := ""
-			client, err := aws.NewAWSClient("us-east-1", stackTemplateRUL, credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     "",
-					SecretAccessKey: "",
-				},
-			})
+			client, err := aws.NewDefAWSClient()
 			if err != nil {
 				return err
 			}
@@ -353,6 +334,11 @@ func NewChainDeployCmd() *cobra.Command {
 					return
 				}
 				logger.L.Infof("deploy success to prometheus: http://%s:9090", publicIP)
+				if err = docker.StartGrafana(publicIP, "http://127.0.0.1:9090"); err != nil {
+					logger.L.Errorf("docker start grafana error: %s", err.Error())
+					return
+				}
+				logger.L.Infof("grafana: http://%s:3000", publicIP)
 			}
 			return nil
 		},
@@ -0,0 +1,142 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"hub/logger"
+
+	"fx-tools/aws"
+	"fx-tools/inventory"
+)
+
+// regionOf the region of the i-th node, the nodes are spread over cfg.Regions round robin
+func (c Config) regionOf(i int) string {
+	if len(c.Regions) == 0 {
+		return ""
+	}
+	return c.Regions[i%len(c.Regions)]
+}
+
+// p2pIP the address other nodes dial, private addresses are not routable between regions
+func (c Config) p2pIP(publicIP, privateIP string) string {
+	if len(c.Regions) > 1 {
+		return publicIP
+	}
+	return privateIP
+}
+
+// instanceTypeOf the instance type of role from the role=type entries of --instance_types,
+// --instance_type, or --seed_instance_type for the seed, otherwise
+func (c Config) instanceTypeOf(role string) string {
+	for _, entry := range c.InstanceTypes {
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			logger.L.Warnf("instance type %q is not role=type", entry)
+			continue
+		}
+		if kv[0] == role {
+			return kv[1]
+		}
+	}
+	if role == inventory.RoleSeed && c.SeedInstanceType != "" {
+		return c.SeedInstanceType
+	}
+	return c.InstanceType
+}
+
+// instanceOptions how the i-th node of role is launched
+func (c Config) instanceOptions(role string, i int) aws.InstanceOptions {
+	return aws.InstanceOptions{
+		Region:       c.regionOf(i),
+		InstanceType: c.instanceTypeOf(role),
+		DiskSize:     c.DiskSize,
+		Spot:         c.Spot,
+		SpotMaxPrice: c.SpotMaxPrice,
+	}
+}
+
+// nodeOf the inventory node of a launched instance
+func nodeOf(instance *aws.Instance, role string) inventory.Node {
+	return inventory.Node{
+		Name:         instance.StackName,
+		Role:         role,
+		PublicIP:     instance.PublicIP,
+		PrivateIP:    instance.PrivateIP,
+		StackName:    instance.StackName,
+		InstanceID:   instance.InstanceId,
+		Region:       instance.Region,
+		InstanceType: instance.InstanceType,
+		Market:       instance.Market,
+	}
+}
+
+// checkRegions rejects the regional [aws] settings when the nodes are spread over several regions
+func (c Config) checkRegions() error {
+	if len(c.Regions) <= 1 {
+		return nil
+	}
+	awsCfg := aws.GetClientConfig()
+	for name, value := range map[string]string{"ami": awsCfg.AMI, "ami_arm64": awsCfg.AMIArm64, "vpc_id": awsCfg.VpcId, "subnet_id": awsCfg.SubnetId} {
+		// an SSM parameter name resolves in every region, an image id does not
+		if name == "ami" || name == "ami_arm64" {
+			if !strings.HasPrefix(value, "ami-") {
+				continue
+			}
+		} else if value == "" {
+			continue
+		}
+		return fmt.Errorf("[aws] %s %s only exists in one region, unset it to deploy to %s", name, value, strings.Join(c.Regions, ","))
+	}
+	return nil
+}
+
+// regionLimits a semaphore per region, stacks are created in parallel in every region
+func regionLimits(regions []string, parallel int) map[string]chan struct{} {
+	limits := map[string]chan struct{}{"": make(chan struct{}, parallel)}
+	for _, region := range regions {
+		limits[region] = make(chan struct{}, parallel)
+	}
+	return limits
+}
+
+// withNodeID the node with the id of its started tendermint node, unchanged when the node does not answer
+func withNodeID(node inventory.Node) inventory.Node {
+	id, err := waitNodeID(node.PublicIP)
+	if err != nil {
+		logger.L.Warnf("node id of %s: %s", node.Name, err.Error())
+		return node
+	}
+	node.NodeID = id
+	return node
+}
+
+var inventoryMu sync.Mutex
+
+// recordNode saves the ssh key of the node and adds the node to the inventory of network.
+// Without network only the key is saved, in the default key dir
+func recordNode(network string, node inventory.Node, key string) {
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	if key != "" {
+		path, err := inventory.SaveKey(network, node.StackName, node.PublicIP, []byte(key))
+		if err != nil {
+			logger.L.Errorf("save ssh key of %s error: %s", node.Name, err.Error())
+		}
+		node.SSHKey = path
+	}
+	if network == "" {
+		logger.L.Infof("ssh key of %s: %s", node.Name, node.SSHKey)
+		return
+	}
+	n, err := inventory.LoadOrNew(network, inventory.ProviderAWS)
+	if err != nil {
+		logger.L.Errorf("load network %s error: %s", network, err.Error())
+		return
+	}
+	n.AddNode(node)
+	if err = n.Save(); err != nil {
+		logger.L.Errorf("save network %s error: %s", network, err.Error())
+	}
+}
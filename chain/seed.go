@@ -0,0 +1,116 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"hub/logger"
+
+	"fx-tools/aws"
+	"fx-tools/cmd"
+	"fx-tools/docker"
+	"fx-tools/inventory"
+	"fx-tools/rpc"
+
+	"github.com/spf13/viper"
+)
+
+// resolveSeeds fills config.p2p.seeds when it is not set: from the seed on --seed_ip,
+// or, if launch, from a new seed node
+func resolveSeeds(cfg *Config, launch bool) error {
+	if cfg.P2P.Seeds != "" {
+		return nil
+	}
+	nodeID := cmd.GetNodeKey(cfg.SeedSecret).ID()
+	if cfg.SeedIP != "" {
+		cfg.P2P.Seeds = fmt.Sprintf("%s@%s:26656", nodeID, cfg.SeedIP)
+		return nil
+	}
+	if !launch {
+		logger.L.Warnf("no seed, set --config.p2p.seeds or --seed_ip")
+		return nil
+	}
+
+	region := cfg.regionOf(0)
+	instance, err := DeploySeedNode(region, cfg.SeedSecret, viper.GetString("chain_id"), cfg.instanceTypeOf(inventory.RoleSeed), cfg.DiskSize)
+	if err != nil {
+		return err
+	}
+	cfg.P2P.Seeds = fmt.Sprintf("%s@%s:26656", nodeID, cfg.p2pIP(instance.PublicIP, instance.PrivateIP))
+	fmt.Printf("seed: %s, publicIP: %s, privateIP: %s, region: %s, peers: http://%s:26680/peers\n", cfg.P2P.Seeds, instance.PublicIP, instance.PrivateIP, instance.Region, instance.PublicIP)
+	node := nodeOf(instance, inventory.RoleSeed)
+	node.NodeID = string(nodeID)
+	recordNode(cfg.Network, node, instance.PrivateKey)
+	return nil
+}
+
+// DeploySeedNode runs `fx seed` in a container on a new instance in region
+func DeploySeedNode(region, secret, chainID, instanceType, diskSize string) (*aws.Instance, error) {
+	if secret == "" {
+		// a random node key would leave the seed id unknown
+		return nil, errors.New("seed secret is empty")
+	}
+	stackName := fmt.Sprintf("fx-chain-%s-seed-%d", os.ExpandEnv("$USER"), time.Now().UnixNano()/1000)
+	instance, err := aws.LaunchInstance(stackName, aws.InstanceOptions{Region: region, InstanceType: instanceType, DiskSize: diskSize})
+	if err != nil {
+		return nil, err
+	}
+	return instance, docker.StartSeed(instance.PublicIP, []string{"--secret", secret, "--chain_id", chainID})
+}
+
+// DeploySentryNodes runs count full nodes that are the only peers of the validator on validatorPublicIP,
+// they keep dialing it and never gossip its address. The sentries share the region of the validator,
+// like the peer, the genesis is fetched over its private IP
+func DeploySentryNodes(cfgStr, region, validatorPublicIP, validatorPrivateIP string, count, index int) ([]string, error) {
+	validatorID, err := waitNodeID(validatorPublicIP)
+	if err != nil {
+		return nil, err
+	}
+	validatorPeer := fmt.Sprintf("%s@%s:26656", validatorID, validatorPrivateIP)
+
+	var sentries []string
+	for i := 0; i < count; i++ {
+		var cfg Config
+		(&cfg).JsonUnmarshal(cfgStr)
+
+		stackName := fmt.Sprintf("fx-chain-%s-sentry-%d-%d-%d", os.ExpandEnv("$USER"), index, i, time.Now().UnixNano()/1000)
+		opts := cfg.instanceOptions(inventory.RoleSentry, index)
+		opts.Region = region
+		instance, err := aws.LaunchInstance(stackName, opts)
+		if err != nil {
+			return sentries, err
+		}
+		publicIP, privateIP := instance.PublicIP, instance.PrivateIP
+
+		cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%s:26656", cfg.p2pIP(publicIP, privateIP))
+		cfg.P2P.PexReactor = true
+		cfg.P2P.PersistentPeers = validatorPeer
+		cfg.P2P.UnconditionalPeerIDs = validatorID
+		cfg.P2P.PrivatePeerIDs = validatorID
+		if err = docker.StartChain(publicIP, append([]string{"normal"}, cfg.ChainConfig.String(), fmt.Sprintf("http://%s:26657", validatorPrivateIP))); err != nil {
+			return sentries, err
+		}
+		fmt.Printf("sentry: http://%s:26657, name: %s, validator: %s, publicIP: %s, privateIP: %s, region: %s, instanceType: %s, market: %s\n",
+			publicIP, stackName, validatorID, publicIP, privateIP, instance.Region, instance.InstanceType, instance.Market)
+		recordNode(cfg.Network, withNodeID(nodeOf(instance, inventory.RoleSentry)), instance.PrivateKey)
+		sentries = append(sentries, publicIP)
+	}
+	return sentries, nil
+}
+
+// waitNodeID the node id of a node that has just been started
+func waitNodeID(ip string) (string, error) {
+	cli := rpc.NewClient(fmt.Sprintf("http://%s:26657", ip))
+	var err error
+	for i := 0; i < 30; i++ {
+		status, statusErr := cli.Status()
+		if statusErr == nil {
+			return string(status.NodeInfo.ID()), nil
+		}
+		err = statusErr
+		time.Sleep(2 * time.Second)
+	}
+	return "", fmt.Errorf("node %s status: %s", ip, err.Error())
+}
@@ -0,0 +1,264 @@
+package chain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"hub/logger"
+
+	"fx-tools/docker"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	sm "github.com/tendermint/tendermint/state"
+	dbm "github.com/tendermint/tm-db"
+)
+
+const (
+	nodeHomeDir            = "/root/.fx"
+	nodeDataDir            = "/root/.fx/data"
+	privValidatorStateFile = "/root/.fx/data/priv_validator_state.json"
+	stateDBDir             = "/root/.fx/data/state.db"
+	genesisFile            = "/root/.fx/config/genesis.json"
+)
+
+func NewChainSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "snapshot",
+		Short:   "archive and restore the node data directory",
+		Example: "fx chain snapshot --help",
+	}
+	cmd.PersistentFlags().String("store", "./snapshots", "local directory or s3://<bucket>/<prefix>")
+	cmd.AddCommand(
+		NewChainSnapshotCreateCmd(),
+		NewChainSnapshotRestoreCmd(),
+		NewChainSnapshotListCmd(),
+	)
+	return cmd
+}
+
+func NewChainSnapshotCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "create",
+		Example: "fx chain snapshot create --ip 127.0.0.1 --store s3://fx-snapshots/testnet",
+		RunE: func(*cobra.Command, []string) (err error) {
+			store, err := NewSnapshotStore(viper.GetString("store"))
+			if err != nil {
+				return err
+			}
+			meta, err := CreateSnapshot(viper.GetString("ip"), store, viper.GetBool("keep_stopped"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("snapshot: %s, chain id: %s, height: %d, app hash: %s\n", meta.Name, meta.ChainID, meta.Height, meta.AppHash)
+			return nil
+		},
+	}
+	cmd.Flags().Bool("keep_stopped", false, "do not start the node again once archived")
+	return cmd
+}
+
+func NewChainSnapshotRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore",
+		Example: "fx chain snapshot restore --ip 127.0.0.1 --name hub-10000",
+		RunE: func(*cobra.Command, []string) (err error) {
+			store, err := NewSnapshotStore(viper.GetString("store"))
+			if err != nil {
+				return err
+			}
+			return RestoreSnapshot(viper.GetString("ip"), store, viper.GetString("name"))
+		},
+	}
+	cmd.Flags().String("name", "", "snapshot name")
+	_ = cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func NewChainSnapshotListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Example: "fx chain snapshot list --store ./snapshots",
+		RunE: func(*cobra.Command, []string) (err error) {
+			store, err := NewSnapshotStore(viper.GetString("store"))
+			if err != nil {
+				return err
+			}
+			list, err := store.List()
+			if err != nil {
+				return err
+			}
+			for _, meta := range list {
+				fmt.Printf("name: %s, chain id: %s, height: %d, app hash: %s, node: %s, time: %s\n",
+					meta.Name, meta.ChainID, meta.Height, meta.AppHash, meta.Node, meta.Time.Format("2006-01-02T15:04:05Z"))
+			}
+			fmt.Printf("Total: %d\n", len(list))
+			return nil
+		},
+	}
+	return cmd
+}
+
+// CreateSnapshot stops the node and archives its data directory,
+// the recorded height and app hash are read from the state of the stopped node
+func CreateSnapshot(ip string, store SnapshotStore, keepStopped bool) (meta SnapshotMeta, err error) {
+	cli, err := docker.NewCli(fmt.Sprintf("tcp://%s:2376", ip))
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	inspect, err := cli.ContainerInspect(ctx, "fx-chain")
+	if err != nil {
+		return
+	}
+	if err = cli.ContainerStop(ctx, inspect.ID, nil); err != nil {
+		return
+	}
+	if !keepStopped {
+		defer func() {
+			if err := cli.ContainerStart(ctx, inspect.ID, types.ContainerStartOptions{}); err != nil {
+				logger.L.Errorf("docker start %s error: %s", ip, err.Error())
+			}
+		}()
+	}
+
+	state, err := stoppedState(cli, inspect.ID)
+	if err != nil {
+		return
+	}
+	meta = SnapshotMeta{
+		Name:    fmt.Sprintf("%s-%d", state.ChainID, state.LastBlockHeight),
+		ChainID: state.ChainID,
+		Height:  state.LastBlockHeight,
+		AppHash: fmt.Sprintf("%X", state.AppHash),
+		Node:    ip,
+		Time:    time.Now().UTC(),
+	}
+	logger.L.Infof("archive %s:%s, height: %d", ip, nodeDataDir, meta.Height)
+
+	tarReader, _, err := cli.CopyFromContainer(ctx, inspect.ID, nodeDataDir)
+	if err != nil {
+		return
+	}
+	defer tarReader.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, tarReader)
+		if err == nil {
+			err = gz.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	err = store.Put(meta, pr)
+	_ = pr.Close()
+	return
+}
+
+// stoppedState loads the tendermint state of a stopped container from a copy of its state.db
+func stoppedState(cli *client.Client, container string) (state sm.State, err error) {
+	dir, err := ioutil.TempDir("", "fx-snapshot")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	reader, _, err := cli.CopyFromContainer(context.Background(), container, stateDBDir)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	if _, _, err = docker.ExtractTar(reader, dir); err != nil {
+		return
+	}
+	db, err := dbm.NewGoLevelDB("state", dir)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	state = sm.LoadState(db)
+	if state.IsEmpty() {
+		err = fmt.Errorf("no state in %s", stateDBDir)
+	}
+	return
+}
+
+// RestoreSnapshot replaces the data directory of the stopped node with the snapshot,
+// keeping the node's own priv_validator_state.json so a validator can not double sign
+func RestoreSnapshot(ip string, store SnapshotStore, name string) error {
+	archive, meta, err := store.Get(name)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	cli, err := docker.NewCli(fmt.Sprintf("tcp://%s:2376", ip))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	inspect, err := cli.ContainerInspect(ctx, "fx-chain")
+	if err != nil {
+		return err
+	}
+	data, err := docker.ReadFile(cli, inspect.ID, genesisFile)
+	if err != nil {
+		return err
+	}
+	var genesis struct {
+		ChainID string `json:"chain_id"`
+	}
+	if err = json.Unmarshal(data, &genesis); err != nil {
+		return err
+	}
+	if genesis.ChainID != meta.ChainID {
+		return fmt.Errorf("snapshot chain id %s, node chain id %s", meta.ChainID, genesis.ChainID)
+	}
+
+	if inspect.State.Running {
+		if err = cli.ContainerStop(ctx, inspect.ID, nil); err != nil {
+			return err
+		}
+	}
+	// read once stopped, the node no longer signs
+	privState, err := readFromContainer(cli, inspect.ID, privValidatorStateFile)
+	if err != nil {
+		return fmt.Errorf("read %s: %s", privValidatorStateFile, err.Error())
+	}
+	if err = docker.ClearDir(cli, inspect.ID, nodeDataDir); err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	logger.L.Infof("restore %s to %s:%s, height: %d", name, ip, nodeDataDir, meta.Height)
+	if err = cli.CopyToContainer(ctx, inspect.ID, nodeHomeDir, gz, types.CopyToContainerOptions{}); err != nil {
+		return err
+	}
+	if err = cli.CopyToContainer(ctx, inspect.ID, nodeDataDir, bytes.NewReader(privState), types.CopyToContainerOptions{}); err != nil {
+		return err
+	}
+	return cli.ContainerStart(ctx, inspect.ID, types.ContainerStartOptions{})
+}
+
+// readFromContainer returns the tar archive of path
+func readFromContainer(cli *client.Client, container, path string) ([]byte, error) {
+	reader, _, err := cli.CopyFromContainer(context.Background(), container, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
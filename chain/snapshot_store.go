@@ -0,0 +1,183 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fx-tools/aws"
+)
+
+type SnapshotMeta struct {
+	Name    string    `json:"name"`
+	ChainID string    `json:"chain_id"`
+	Height  int64     `json:"height"`
+	AppHash string    `json:"app_hash"`
+	Node    string    `json:"node"`
+	Time    time.Time `json:"time"`
+}
+
+// SnapshotStore keeps gzipped tar archives of a node data directory next to their metadata
+type SnapshotStore interface {
+	Put(meta SnapshotMeta, archive io.Reader) error
+	Get(name string) (io.ReadCloser, SnapshotMeta, error)
+	List() ([]SnapshotMeta, error)
+}
+
+// NewSnapshotStore a local directory, or a bucket when location is s3://<bucket>/<prefix>
+func NewSnapshotStore(location string) (SnapshotStore, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return &localSnapshotStore{dir: location}, nil
+	}
+	bucketPrefix := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if bucketPrefix[0] == "" {
+		return nil, fmt.Errorf("invalid snapshot store: %s", location)
+	}
+	client, err := aws.NewDefAWSClient()
+	if err != nil {
+		return nil, err
+	}
+	store := &s3SnapshotStore{client: client, bucket: bucketPrefix[0]}
+	if len(bucketPrefix) > 1 {
+		store.prefix = strings.Trim(bucketPrefix[1], "/")
+	}
+	return store, nil
+}
+
+func archiveName(name string) string {
+	return fmt.Sprintf("%s.tar.gz", name)
+}
+
+func metaName(name string) string {
+	return fmt.Sprintf("%s.json", name)
+}
+
+type localSnapshotStore struct {
+	dir string
+}
+
+func (s *localSnapshotStore) Put(meta SnapshotMeta, archive io.Reader) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(s.dir, archiveName(meta.Name)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = io.Copy(file, archive); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.dir, metaName(meta.Name)), data, 0644)
+}
+
+func (s *localSnapshotStore) Get(name string) (io.ReadCloser, SnapshotMeta, error) {
+	var meta SnapshotMeta
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, metaName(name)))
+	if err != nil {
+		return nil, meta, err
+	}
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return nil, meta, err
+	}
+	file, err := os.Open(filepath.Join(s.dir, archiveName(name)))
+	return file, meta, err
+}
+
+func (s *localSnapshotStore) List() ([]SnapshotMeta, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var list []SnapshotMeta
+	for _, file := range files {
+		_, meta, err := s.Get(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, meta)
+	}
+	sortSnapshots(list)
+	return list, nil
+}
+
+type s3SnapshotStore struct {
+	client *aws.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3SnapshotStore) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *s3SnapshotStore) Put(meta SnapshotMeta, archive io.Reader) error {
+	if err := aws.PutObject(s.client, s.bucket, s.key(archiveName(meta.Name)), archive); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return aws.PutObject(s.client, s.bucket, s.key(metaName(meta.Name)), bytes.NewReader(data))
+}
+
+func (s *s3SnapshotStore) getMeta(key string) (meta SnapshotMeta, err error) {
+	body, err := aws.GetObject(s.client, s.bucket, key)
+	if err != nil {
+		return
+	}
+	defer body.Close()
+	err = json.NewDecoder(body).Decode(&meta)
+	return
+}
+
+func (s *s3SnapshotStore) Get(name string) (io.ReadCloser, SnapshotMeta, error) {
+	meta, err := s.getMeta(s.key(metaName(name)))
+	if err != nil {
+		return nil, meta, err
+	}
+	body, err := aws.GetObject(s.client, s.bucket, s.key(archiveName(name)))
+	return body, meta, err
+}
+
+func (s *s3SnapshotStore) List() ([]SnapshotMeta, error) {
+	keys, err := aws.ListObjectKeys(s.client, s.bucket, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var list []SnapshotMeta
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		meta, err := s.getMeta(key)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, meta)
+	}
+	sortSnapshots(list)
+	return list, nil
+}
+
+func sortSnapshots(list []SnapshotMeta) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ChainID != list[j].ChainID {
+			return list[i].ChainID < list[j].ChainID
+		}
+		return list[i].Height < list[j].Height
+	})
+}
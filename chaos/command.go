@@ -0,0 +1,207 @@
+package chaos
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"hub/logger"
+
+	"fx-tools/docker"
+	"fx-tools/inventory"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defSidecarImage = "nicolaka/netshoot:latest"
+
+func NewChaosCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "chaos",
+		Short:   "fault injection",
+		Example: "fx chaos --help",
+	}
+	cmd.AddCommand(NewChaosNetCmd())
+	return cmd
+}
+
+func NewChaosNetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "net",
+		Short:   "delay and drop the traffic sent by --from nodes to --to nodes",
+		Example: "fx chaos net --network test --from node0,node1 --to node2,node3 --delay 100ms --jitter 10ms --loss 1",
+		RunE: func(*cobra.Command, []string) error {
+			netem := Netem{
+				Delay:  viper.GetDuration("delay"),
+				Jitter: viper.GetDuration("jitter"),
+				Loss:   viper.GetFloat64("loss"),
+			}
+			if netem.IsEmpty() {
+				return fmt.Errorf("either --delay or --loss is required")
+			}
+			if err := netem.Validate(); err != nil {
+				return err
+			}
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			from, err := network.Select(viper.GetStringSlice("from"))
+			if err != nil {
+				return err
+			}
+			var targets []string
+			if to := viper.GetStringSlice("to"); len(to) > 0 {
+				nodes, err := network.Select(to)
+				if err != nil {
+					return err
+				}
+				targets = nodeIPs(nodes)
+			}
+			dev := viper.GetString("dev")
+			return runOnNodes(from, func(inventory.Node) string {
+				return NetemScript(dev, netem, targets)
+			})
+		},
+	}
+	cmd.PersistentFlags().String("network", "", "network name")
+	cmd.PersistentFlags().String("dev", "eth0", "network interface inside the node network namespace")
+	cmd.PersistentFlags().String("image", defSidecarImage, "sidecar image providing tc and iptables")
+	cmd.Flags().StringSlice("from", []string{}, "nodes whose egress traffic is shaped, all nodes if empty")
+	cmd.Flags().StringSlice("to", []string{}, "only shape traffic sent to these nodes, all traffic if empty")
+	cmd.Flags().Duration("delay", 0, "")
+	cmd.Flags().Duration("jitter", 0, "")
+	cmd.Flags().Float64("loss", 0, "packet loss percent")
+	_ = cmd.MarkPersistentFlagRequired("network")
+	cmd.AddCommand(NewChaosPartitionCmd(), NewChaosHealCmd())
+	return cmd
+}
+
+func NewChaosPartitionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "partition",
+		Short:   "cut the network between groups of nodes",
+		Example: "fx chaos net partition --network test --group node0,node1 --group node2,node3",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			groups, err := cmd.Flags().GetStringArray("group")
+			if err != nil {
+				return err
+			}
+			if len(groups) < 2 {
+				return fmt.Errorf("at least two --group are required")
+			}
+			var groupNodes = make([][]inventory.Node, len(groups))
+			for i, group := range groups {
+				if groupNodes[i], err = network.Select(strings.Split(group, ",")); err != nil {
+					return err
+				}
+			}
+			var nodes []inventory.Node
+			var peers = make(map[string][]string)
+			for i, group := range groupNodes {
+				var others []inventory.Node
+				for j := range groupNodes {
+					if j != i {
+						others = append(others, groupNodes[j]...)
+					}
+				}
+				for _, node := range group {
+					nodes = append(nodes, node)
+					peers[node.Name] = nodeIPs(others)
+				}
+			}
+			return runOnNodes(nodes, func(node inventory.Node) string {
+				return PartitionScript(peers[node.Name])
+			})
+		},
+	}
+	// StringArray, a group is itself a comma separated list
+	cmd.Flags().StringArray("group", []string{}, "comma separated nodes, repeat for every group")
+	return cmd
+}
+
+func NewChaosHealCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "heal",
+		Short:   "remove every injected network fault",
+		Example: "fx chaos net heal --network test",
+		RunE: func(*cobra.Command, []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			nodes, err := network.Select(viper.GetStringSlice("node"))
+			if err != nil {
+				return err
+			}
+			dev := viper.GetString("dev")
+			return runOnNodes(nodes, func(inventory.Node) string {
+				return HealScript(dev)
+			})
+		},
+	}
+	cmd.Flags().StringSlice("node", []string{}, "all nodes if empty")
+	return cmd
+}
+
+// runOnNodes runs the script in a privileged sidecar sharing the network namespace of every node container
+func runOnNodes(nodes []inventory.Node, script func(inventory.Node) string) error {
+	image := viper.GetString("image")
+	wg := sync.WaitGroup{}
+	var failed = make(chan string, len(nodes))
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node inventory.Node) {
+			defer wg.Done()
+			if err := runSidecar(image, node, script(node)); err != nil {
+				logger.L.Errorf("node %s chaos error: %s", node.Name, err.Error())
+				failed <- node.Name
+				return
+			}
+			logger.L.Infof("node %s chaos applied", node.Name)
+		}(node)
+	}
+	wg.Wait()
+	close(failed)
+
+	var names []string
+	for name := range failed {
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("failed nodes: %s", strings.Join(names, ","))
+	}
+	return nil
+}
+
+func runSidecar(image string, node inventory.Node, script string) error {
+	cli, err := docker.NewCli(node.DockerEndpoint())
+	if err != nil {
+		return err
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(fmt.Sprintf("container:%s", node.ContainerName())),
+		CapAdd:      strslice.StrSlice{"NET_ADMIN"},
+	}
+	name := fmt.Sprintf("fx-chaos-%s", node.ContainerName())
+	output, err := docker.RunOnce(cli, image, name, []string{"sh", "-c", script}, hostConfig)
+	if output != "" {
+		logger.L.Debugf("node %s chaos output: %s", node.Name, output)
+	}
+	return err
+}
+
+func nodeIPs(nodes []inventory.Node) []string {
+	var ips []string
+	for _, node := range nodes {
+		ips = append(ips, node.IPs()...)
+	}
+	return ips
+}
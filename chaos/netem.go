@@ -0,0 +1,94 @@
+package chaos
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const chain = "FX-CHAOS"
+
+// Netem the tc netem fault applied to egress traffic
+type Netem struct {
+	Delay  time.Duration
+	Jitter time.Duration
+	Loss   float64
+}
+
+func (n Netem) IsEmpty() bool {
+	return n.Delay <= 0 && n.Loss <= 0
+}
+
+// Validate rejects the values tc would refuse or misread
+func (n Netem) Validate() error {
+	if n.Delay < 0 || n.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must not be negative")
+	}
+	if n.Loss < 0 || n.Loss > 100 {
+		return fmt.Errorf("loss %g%% is not within 0 and 100", n.Loss)
+	}
+	return nil
+}
+
+func (n Netem) String() string {
+	var args []string
+	if n.Delay > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dms", n.Delay.Milliseconds()))
+		if n.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dms", n.Jitter.Milliseconds()), "distribution", "normal")
+		}
+	}
+	if n.Loss > 0 {
+		args = append(args, "loss", fmt.Sprintf("%g%%", n.Loss))
+	}
+	return strings.Join(args, " ")
+}
+
+// NetemScript shapes the traffic sent to targets, or all egress traffic when targets is empty
+func NetemScript(dev string, netem Netem, targets []string) string {
+	lines := []string{
+		fmt.Sprintf("tc qdisc del dev %s root 2>/dev/null", dev),
+		"set -e",
+	}
+	if len(targets) <= 0 {
+		lines = append(lines, fmt.Sprintf("tc qdisc add dev %s root netem %s", dev, netem))
+		return strings.Join(lines, "\n")
+	}
+	lines = append(lines,
+		fmt.Sprintf("tc qdisc add dev %s root handle 1: prio bands 4", dev),
+		fmt.Sprintf("tc qdisc add dev %s parent 1:4 handle 40: netem %s", dev, netem),
+	)
+	for _, ip := range targets {
+		lines = append(lines, fmt.Sprintf("tc filter add dev %s parent 1:0 protocol ip prio 1 u32 match ip dst %s/32 flowid 1:4", dev, ip))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PartitionScript drops every packet exchanged with peers
+func PartitionScript(peers []string) string {
+	lines := []string{
+		fmt.Sprintf("iptables -N %s 2>/dev/null || iptables -F %s", chain, chain),
+		fmt.Sprintf("iptables -C INPUT -j %s 2>/dev/null || iptables -I INPUT -j %s", chain, chain),
+		fmt.Sprintf("iptables -C OUTPUT -j %s 2>/dev/null || iptables -I OUTPUT -j %s", chain, chain),
+		"set -e",
+	}
+	for _, ip := range peers {
+		lines = append(lines,
+			fmt.Sprintf("iptables -A %s -s %s -j DROP", chain, ip),
+			fmt.Sprintf("iptables -A %s -d %s -j DROP", chain, ip),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HealScript removes every fault installed by NetemScript and PartitionScript
+func HealScript(dev string) string {
+	return strings.Join([]string{
+		fmt.Sprintf("tc qdisc del dev %s root 2>/dev/null", dev),
+		fmt.Sprintf("iptables -D INPUT -j %s 2>/dev/null", chain),
+		fmt.Sprintf("iptables -D OUTPUT -j %s 2>/dev/null", chain),
+		fmt.Sprintf("iptables -F %s 2>/dev/null", chain),
+		fmt.Sprintf("iptables -X %s 2>/dev/null", chain),
+		"true",
+	}, "\n")
+}
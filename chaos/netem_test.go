@@ -0,0 +1,39 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Netem_String(t *testing.T) {
+	assert.Equal(t, "delay 100ms 10ms distribution normal loss 1.5%", Netem{Delay: 100 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 1.5}.String())
+	assert.Equal(t, "loss 2%", Netem{Loss: 2}.String())
+	assert.True(t, Netem{Jitter: time.Second}.IsEmpty())
+}
+
+func Test_Netem_Validate(t *testing.T) {
+	assert.NoError(t, Netem{Loss: 100}.Validate())
+	assert.NoError(t, Netem{Delay: time.Second, Jitter: time.Millisecond}.Validate())
+	assert.Error(t, Netem{Loss: 101}.Validate())
+	assert.Error(t, Netem{Loss: -1}.Validate())
+	assert.Error(t, Netem{Delay: -time.Second}.Validate())
+}
+
+func Test_NetemScript_Targets(t *testing.T) {
+	script := NetemScript("eth0", Netem{Delay: 50 * time.Millisecond}, []string{"10.0.0.2", "10.0.0.3"})
+	assert.Contains(t, script, "tc qdisc add dev eth0 parent 1:4 handle 40: netem delay 50ms")
+	assert.Contains(t, script, "match ip dst 10.0.0.2/32 flowid 1:4")
+	assert.Contains(t, script, "match ip dst 10.0.0.3/32 flowid 1:4")
+
+	script = NetemScript("eth0", Netem{Loss: 1}, nil)
+	assert.Contains(t, script, "tc qdisc add dev eth0 root netem loss 1%")
+}
+
+func Test_PartitionScript(t *testing.T) {
+	script := PartitionScript([]string{"10.0.0.2"})
+	assert.Contains(t, script, "iptables -A FX-CHAOS -s 10.0.0.2 -j DROP")
+	assert.Contains(t, script, "iptables -A FX-CHAOS -d 10.0.0.2 -j DROP")
+	assert.Contains(t, HealScript("eth0"), "iptables -X FX-CHAOS")
+}
@@ -8,6 +8,7 @@ import (
 	"hub/client"
 
 	"fx-tools/aws"
+	"fx-tools/inventory"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -24,11 +25,54 @@ func NewDoctorCmd() *cobra.Command {
 	}
 	cmd.PersistentFlags().Uint("port", 26657, "RPC")
 	cmd.PersistentFlags().String("grep", "", "")
+	cmd.PersistentFlags().String("network", "", "network name, takes precedence over grep")
 	cmd.MarkFlagRequired("grep")
-	cmd.AddCommand(NewCheckChainCmd())
+	cmd.AddCommand(NewCheckChainCmd(), NewStallCmd(), NewValidatorsCmd(), NewPeersCmd())
 	return cmd
 }
 
+// doctorNodes the nodes of --network, or the aws stacks whose name contains --grep
+func doctorNodes() ([]inventory.Node, error) {
+	if name := viper.GetString("network"); name != "" {
+		network, err := inventory.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		return network.Nodes, nil
+	}
+
+	awsCli, err := aws.NewDefAWSClient()
+	if err != nil {
+		return nil, err
+	}
+	stacksSummaries, err := aws.ListCreateCompleteStacks(awsCli)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []inventory.Node
+	for _, summaries := range stacksSummaries {
+		if !strings.Contains(*summaries.StackName, viper.GetString("grep")) {
+			continue
+		}
+		publicIP, privateIP, instanceId, err := aws.GetCfStackIP(awsCli, *summaries.StackName)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, inventory.Node{
+			Name:       *summaries.StackName,
+			PublicIP:   publicIP,
+			PrivateIP:  privateIP,
+			RPCPort:    viper.GetUint("port"),
+			StackName:  *summaries.StackName,
+			InstanceID: instanceId,
+		})
+	}
+	if len(nodes) <= 0 {
+		return nil, fmt.Errorf("no found node by: %s", viper.GetString("grep"))
+	}
+	return nodes, nil
+}
+
 func CheckValidator() (err error) {
 
 	awsCli, err := aws.NewDefAWSClient()
@@ -77,16 +121,18 @@ func CheckValidator() (err error) {
 		return
 	}
 
-	for i := 0; i < len(initValidators.Validators); i++ {
-		for j := 0; j < len(nowValidators.Validators); j++ {
-			if initValidators.Validators[i].Address.String() == nowValidators.Validators[j].Address.String() {
-				initValidators.Validators = append(initValidators.Validators[:i], initValidators.Validators[i+1:]...)
-				nowValidators.Validators = append(nowValidators.Validators[:j], nowValidators.Validators[j+1:]...)
-				i--
-				break
-			}
+	// validators of height 1 no longer in the current set
+	var nowAddresses = make(map[string]bool)
+	for _, validator := range nowValidators.Validators {
+		nowAddresses[validator.Address.String()] = true
+	}
+	removed := initValidators.Validators[:0]
+	for _, validator := range initValidators.Validators {
+		if !nowAddresses[validator.Address.String()] {
+			removed = append(removed, validator)
 		}
 	}
+	initValidators.Validators = removed
 
 	for i, validator := range initValidators.Validators {
 		//cli.ABCIQuery(context.Background(), "/store/staking/key", types.GetValidatorKey(addr))
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"hub/logger"
+
+	"fx-tools/inventory"
+	"fx-tools/rpc"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	coreTypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+type PeerVertex struct {
+	ID        string `json:"id"`
+	Name      string `json:"name,omitempty"`
+	Moniker   string `json:"moniker,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Validator bool   `json:"validator"`
+	// Polled the node /net_info was queried on, only those have a known peer count
+	Polled bool `json:"polled"`
+	Peers  int  `json:"peers"`
+}
+
+type PeerEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	SendRate int64  `json:"send_rate"`
+	RecvRate int64  `json:"recv_rate"`
+}
+
+type PeerGraph struct {
+	Nodes      []*PeerVertex `json:"nodes"`
+	Edges      []*PeerEdge   `json:"edges"`
+	Isolated   []string      `json:"isolated"`
+	BelowMin   []string      `json:"below_min_peers"`
+	Partitions [][]string    `json:"partitions"`
+	vertices   map[string]*PeerVertex
+	edges      map[string]*PeerEdge
+}
+
+func NewPeersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "peers",
+		Short:   "p2p peer topology of every node",
+		Example: "fx doctor peers --network test --min_peers 3 --secret seed=functionx --dot peers.dot --json peers.json",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			nodes, err := doctorNodes()
+			if err != nil {
+				return err
+			}
+			secrets, err := cmd.Flags().GetStringToString("secret")
+			if err != nil {
+				return err
+			}
+			graph := BuildPeerGraph(nodes, secrets, viper.GetInt("min_peers"))
+
+			for _, vertex := range graph.Nodes {
+				if !vertex.Polled {
+					continue
+				}
+				fmt.Printf("node: %s, id: %s, validator: %v, peers: %d\n", vertex.Name, vertex.ID, vertex.Validator, vertex.Peers)
+			}
+			fmt.Printf("isolated: %s\n", strings.Join(graph.names(graph.Isolated), ","))
+			fmt.Printf("below %d peers: %s\n", viper.GetInt("min_peers"), strings.Join(graph.names(graph.BelowMin), ","))
+			fmt.Printf("partitions: %d\n", len(graph.Partitions))
+			if len(graph.Partitions) > 1 {
+				for i, partition := range graph.Partitions {
+					fmt.Printf("\t%d: %s\n", i, strings.Join(graph.names(partition), ","))
+				}
+			}
+
+			if file := viper.GetString("dot"); file != "" {
+				if err = ioutil.WriteFile(file, []byte(graph.DOT()), 0644); err != nil {
+					return err
+				}
+			}
+			if file := viper.GetString("json"); file != "" {
+				data, err := json.MarshalIndent(graph, "", "  ")
+				if err != nil {
+					return err
+				}
+				if err = ioutil.WriteFile(file, data, 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int("min_peers", 2, "report nodes with fewer peers")
+	cmd.Flags().StringToString("secret", map[string]string{}, "name=secret, label the node whose node key is derived from secret")
+	cmd.Flags().String("dot", "", "write the graph in Graphviz DOT to this file")
+	cmd.Flags().String("json", "", "write the graph in json to this file")
+	return cmd
+}
+
+func BuildPeerGraph(nodes []inventory.Node, secrets map[string]string, minPeers int) *PeerGraph {
+	graph := &PeerGraph{vertices: make(map[string]*PeerVertex), edges: make(map[string]*PeerEdge)}
+
+	// node id -> name, from the inventory and the node key secrets
+	var names = make(map[string]string)
+	var validators = make(map[string]bool)
+	for _, node := range nodes {
+		if node.NodeID != "" {
+			names[node.NodeID] = node.Name
+			validators[node.NodeID] = node.Role == inventory.RoleValidator
+		}
+	}
+	for name, secret := range secrets {
+		names[string(GetNodeKey(secret).ID())] = name
+	}
+
+	var statuses = make([]*coreTypes.ResultStatus, len(nodes))
+	var netInfos = make([]*coreTypes.ResultNetInfo, len(nodes))
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node inventory.Node) {
+			defer wg.Done()
+			cli := rpc.NewClient(node.RPC())
+			status, err := cli.Status()
+			if err != nil {
+				logger.L.Warnf("node %s status error: %s", node.Name, err.Error())
+				return
+			}
+			netInfo, err := cli.NetInfo()
+			if err != nil {
+				logger.L.Warnf("node %s net info error: %s", node.Name, err.Error())
+				return
+			}
+			statuses[i], netInfos[i] = status, netInfo
+		}(i, node)
+	}
+	wg.Wait()
+
+	for i, node := range nodes {
+		if statuses[i] == nil {
+			continue
+		}
+		id := string(statuses[i].NodeInfo.ID())
+		vertex := graph.vertex(id)
+		vertex.Name, vertex.Moniker, vertex.IP = node.Name, statuses[i].NodeInfo.Moniker, node.PublicIP
+		vertex.Validator = statuses[i].ValidatorInfo.VotingPower > 0
+		vertex.Polled, vertex.Peers = true, netInfos[i].NPeers
+
+		for _, peer := range netInfos[i].Peers {
+			peerID := string(peer.NodeInfo.ID())
+			peerVertex := graph.vertex(peerID)
+			if peerVertex.Moniker == "" {
+				peerVertex.Moniker, peerVertex.IP = peer.NodeInfo.Moniker, peer.RemoteIP
+			}
+			from, to := id, peerID
+			sendRate, recvRate := peer.ConnectionStatus.SendMonitor.AvgRate, peer.ConnectionStatus.RecvMonitor.AvgRate
+			if !peer.IsOutbound {
+				from, to = to, from
+				sendRate, recvRate = recvRate, sendRate
+			}
+			graph.edge(from, to, sendRate, recvRate)
+		}
+	}
+
+	for id, vertex := range graph.vertices {
+		if vertex.Name == "" {
+			vertex.Name = names[id]
+		}
+		if validators[id] {
+			vertex.Validator = true
+		}
+		if vertex.Polled && vertex.Peers == 0 {
+			graph.Isolated = append(graph.Isolated, id)
+		}
+		if vertex.Polled && vertex.Peers < minPeers {
+			graph.BelowMin = append(graph.BelowMin, id)
+		}
+	}
+	sort.Strings(graph.Isolated)
+	sort.Strings(graph.BelowMin)
+	graph.Partitions = graph.components()
+	return graph
+}
+
+func (g *PeerGraph) vertex(id string) *PeerVertex {
+	vertex, ok := g.vertices[id]
+	if !ok {
+		vertex = &PeerVertex{ID: id}
+		g.vertices[id] = vertex
+		g.Nodes = append(g.Nodes, vertex)
+	}
+	return vertex
+}
+
+// edge both ends of a connection report it, it is only kept once
+func (g *PeerGraph) edge(from, to string, sendRate, recvRate int64) {
+	key := fmt.Sprintf("%s->%s", from, to)
+	if _, ok := g.edges[key]; ok {
+		return
+	}
+	edge := &PeerEdge{From: from, To: to, SendRate: sendRate, RecvRate: recvRate}
+	g.edges[key] = edge
+	g.Edges = append(g.Edges, edge)
+}
+
+// components the connected components of the graph, ignoring the direction of connections
+func (g *PeerGraph) components() [][]string {
+	var adjacent = make(map[string][]string)
+	for _, edge := range g.Edges {
+		adjacent[edge.From] = append(adjacent[edge.From], edge.To)
+		adjacent[edge.To] = append(adjacent[edge.To], edge.From)
+	}
+	var visited = make(map[string]bool)
+	var components [][]string
+	for _, vertex := range g.Nodes {
+		if visited[vertex.ID] {
+			continue
+		}
+		var component []string
+		stack := []string{vertex.ID}
+		visited[vertex.ID] = true
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			component = append(component, id)
+			for _, next := range adjacent[id] {
+				if !visited[next] {
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+		sort.Strings(component)
+		components = append(components, component)
+	}
+	return components
+}
+
+func (g *PeerGraph) names(ids []string) []string {
+	var names []string
+	for _, id := range ids {
+		if vertex, ok := g.vertices[id]; ok && vertex.Name != "" {
+			names = append(names, vertex.Name)
+			continue
+		}
+		names = append(names, id)
+	}
+	return names
+}
+
+func (g *PeerGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph peers {\n")
+	for _, vertex := range g.Nodes {
+		label := vertex.Name
+		if label == "" {
+			label = vertex.Moniker
+		}
+		shape := "ellipse"
+		if vertex.Validator {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q, shape=%s];\n", vertex.ID, fmt.Sprintf("%s\n%.8s", label, vertex.ID), shape)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", edge.From, edge.To, fmt.Sprintf("%d/%d B/s", edge.SendRate, edge.RecvRate))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"hub/logger"
+
+	"fx-tools/inventory"
+	"fx-tools/rpc"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tmTypes "github.com/tendermint/tendermint/types"
+)
+
+func NewStallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stall",
+		Short:   "wait until the chain stops producing blocks and diagnose why",
+		Example: "fx doctor stall --network test --block_time 5s --blocks 3",
+		RunE: func(*cobra.Command, []string) error {
+			nodes, err := doctorNodes()
+			if err != nil {
+				return err
+			}
+			if !viper.GetBool("now") {
+				deadline := time.Duration(viper.GetInt("blocks")) * viper.GetDuration("block_time")
+				waitStall(nodes, deadline, viper.GetDuration("interval"))
+			}
+			return DiagnoseStall(nodes)
+		},
+	}
+	cmd.Flags().Duration("block_time", 5*time.Second, "expected block time")
+	cmd.Flags().Uint("blocks", 3, "stalled once the height has not advanced within this many block times")
+	cmd.Flags().Duration("interval", time.Second, "status poll interval")
+	cmd.Flags().Bool("now", false, "diagnose immediately without waiting for a stall")
+	return cmd
+}
+
+// waitStall returns once the highest height across nodes has not advanced for deadline
+func waitStall(nodes []inventory.Node, deadline, interval time.Duration) {
+	var maxHeight int64
+	lastAdvance := time.Now()
+	for {
+		var height int64
+		for _, node := range nodes {
+			status, err := rpc.NewClient(node.RPC()).Status()
+			if err != nil {
+				logger.L.Debugf("node %s status error: %s", node.Name, err.Error())
+				continue
+			}
+			if status.SyncInfo.LatestBlockHeight > height {
+				height = status.SyncInfo.LatestBlockHeight
+			}
+		}
+		if height > maxHeight {
+			maxHeight = height
+			lastAdvance = time.Now()
+			logger.L.Debugf("height: %d", height)
+		} else if time.Since(lastAdvance) >= deadline {
+			logger.L.Warnf("height %d has not advanced for %s", maxHeight, time.Since(lastAdvance).Round(time.Second))
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+type stallReport struct {
+	node       inventory.Node
+	err        error
+	address    string
+	peers      int
+	state      *rpc.RoundState
+	catchingUp bool
+}
+
+func DiagnoseStall(nodes []inventory.Node) error {
+	var reports = make([]stallReport, len(nodes))
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node inventory.Node) {
+			defer wg.Done()
+			reports[i] = diagnoseNode(node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	// validator address -> node name, for the validators the inventory runs
+	var validatorNodes = make(map[string]string)
+	for _, report := range reports {
+		if report.address != "" {
+			validatorNodes[report.address] = report.node.Name
+		}
+	}
+
+	for _, report := range reports {
+		if report.err != nil {
+			fmt.Printf("node: %s, url: %s, unreachable: %s\n", report.node.Name, report.node.RPC(), report.err.Error())
+			continue
+		}
+		rs := report.state
+		fmt.Printf("node: %s, height: %d, round: %d, step: %s, peers: %d, catching up: %v\n",
+			report.node.Name, rs.Height, rs.Round, rs.Step, report.peers, report.catchingUp)
+		if rs.Validators == nil {
+			continue
+		}
+		votes, ok := rs.RoundVotes()
+		if !ok {
+			fmt.Printf("\tno votes for round %d\n", rs.Round)
+			continue
+		}
+		total := rs.Validators.TotalVotingPower()
+		printMissingVotes("prevote", rs.Validators.Validators, votes.Prevotes, total, validatorNodes)
+		printMissingVotes("precommit", rs.Validators.Validators, votes.Precommits, total, validatorNodes)
+	}
+	return nil
+}
+
+func diagnoseNode(node inventory.Node) (report stallReport) {
+	report.node = node
+	cli := rpc.NewClient(node.RPC())
+	status, err := cli.Status()
+	if err != nil {
+		report.err = err
+		return
+	}
+	report.catchingUp = status.SyncInfo.CatchingUp
+	if status.ValidatorInfo.VotingPower > 0 {
+		report.address = status.ValidatorInfo.Address.String()
+	}
+	netInfo, err := cli.NetInfo()
+	if err != nil {
+		report.err = err
+		return
+	}
+	report.peers = netInfo.NPeers
+	dump, err := cli.DumpConsensusState()
+	if err != nil {
+		report.err = err
+		return
+	}
+	report.state, report.err = cli.DecodeRoundState(dump.RoundState)
+	return
+}
+
+func printMissingVotes(voteType string, validators []*tmTypes.Validator, votes []string, total int64, validatorNodes map[string]string) {
+	missing, power := rpc.MissingVotes(validators, votes)
+	fmt.Printf("\tmissing %s power: %d/%d, more than 1/3: %v\n", voteType, power, total, power*3 > total)
+	for _, validator := range missing {
+		name := validatorNodes[validator.Address.String()]
+		if name == "" {
+			name = "unknown"
+		}
+		fmt.Printf("\t\tvalidator: %s, voting power: %d, node: %s\n", validator.Address, validator.VotingPower, name)
+	}
+}
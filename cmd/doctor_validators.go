@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"hub/app"
+	"hub/client"
+	"hub/common"
+	"hub/logger"
+
+	"fx-tools/inventory"
+	"fx-tools/rpc"
+
+	"github.com/cosmos/cosmos-sdk/x/slashing"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	tmTypes "github.com/tendermint/tendermint/types"
+)
+
+type ValidatorLiveness struct {
+	Address       string    `json:"address"`
+	Operator      string    `json:"operator,omitempty"`
+	Node          string    `json:"node,omitempty"`
+	IP            string    `json:"ip,omitempty"`
+	Signed        int64     `json:"signed"`
+	Missed        int64     `json:"missed"`
+	Uptime        float64   `json:"uptime"`
+	Jailed        bool      `json:"jailed"`
+	Tombstoned    bool      `json:"tombstoned"`
+	MissedCounter int64     `json:"missed_blocks_counter"`
+	JailedUntil   time.Time `json:"jailed_until"`
+}
+
+func NewValidatorsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "validators",
+		Short:   "signed and missed blocks per validator over a height range",
+		Example: "fx doctor validators --network test --from 1000 --to 2000 --sort missed --output json",
+		RunE: func(*cobra.Command, []string) error {
+			nodes, err := doctorNodes()
+			if err != nil {
+				return err
+			}
+			validatorNodes := mapValidatorNodes(nodes)
+			cli := rpc.NewClient(nodes[0].RPC())
+
+			to := viper.GetInt64("to")
+			if to <= 0 {
+				status, err := cli.Status()
+				if err != nil {
+					return err
+				}
+				to = status.SyncInfo.LatestBlockHeight
+			}
+			from := viper.GetInt64("from")
+			if from <= 0 {
+				from = to - 100
+			}
+			if from < 1 {
+				from = 1
+			}
+			if from > to {
+				return fmt.Errorf("--from %d is after --to %d", from, to)
+			}
+
+			liveness, failed := ScanCommits(cli, from, to, viper.GetInt("parallel"))
+			if len(failed) > 0 && int64(len(failed)) == to-from+1 {
+				return fmt.Errorf("no height of %d - %d could be queried: %s", from, to, failed[0].Error)
+			}
+			if err = fillSlashingInfo(cli, liveness); err != nil {
+				logger.L.Warnf("query slashing info error: %s", err.Error())
+			}
+
+			var list []*ValidatorLiveness
+			for address, validator := range liveness {
+				if node, ok := validatorNodes[address]; ok {
+					validator.Node, validator.IP = node.Name, node.PublicIP
+				}
+				list = append(list, validator)
+			}
+			if err = sortLiveness(list, viper.GetString("sort")); err != nil {
+				return err
+			}
+
+			if viper.GetString("output") == "json" {
+				data, err := json.MarshalIndent(struct {
+					From       int64                `json:"from"`
+					To         int64                `json:"to"`
+					Validators []*ValidatorLiveness `json:"validators"`
+					Failed     []FailedHeight       `json:"failed_heights,omitempty"`
+				}{from, to, list, failed}, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			fmt.Printf("heights: %d - %d\n", from, to)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ADDRESS\tNODE\tIP\tSIGNED\tMISSED\tUPTIME\tJAILED\tTOMBSTONED\tMISSED COUNTER")
+			for _, v := range list {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%.2f%%\t%v\t%v\t%d\n",
+					v.Address, v.Node, v.IP, v.Signed, v.Missed, v.Uptime*100, v.Jailed, v.Tombstoned, v.MissedCounter)
+			}
+			if err = w.Flush(); err != nil {
+				return err
+			}
+			if len(failed) > 0 {
+				fmt.Printf("%d heights not counted:\n", len(failed))
+				for _, f := range failed {
+					fmt.Printf("  %d: %s\n", f.Height, f.Error)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int64("from", 0, "first height, 100 blocks before --to by default")
+	cmd.Flags().Int64("to", 0, "last height, the latest height by default")
+	cmd.Flags().Uint("parallel", 10, "concurrent commit queries")
+	cmd.Flags().String("sort", "missed", "missed, signed, uptime, address or node")
+	cmd.Flags().String("output", "table", "table or json")
+	return cmd
+}
+
+// mapValidatorNodes validator address -> the inventory node running it
+func mapValidatorNodes(nodes []inventory.Node) map[string]inventory.Node {
+	var validatorNodes = make(map[string]inventory.Node)
+	for _, node := range nodes {
+		status, err := rpc.NewClient(node.RPC()).Status()
+		if err != nil {
+			logger.L.Warnf("node %s status error: %s", node.Name, err.Error())
+			continue
+		}
+		if status.ValidatorInfo.VotingPower > 0 {
+			validatorNodes[status.ValidatorInfo.Address.String()] = node
+		}
+	}
+	return validatorNodes
+}
+
+// FailedHeight a height whose commit or validator set could not be queried
+type FailedHeight struct {
+	Height int64  `json:"height"`
+	Error  string `json:"error"`
+}
+
+// ScanCommits counts, for every validator of every height in [from, to], whether its signature is in the commit.
+// Heights that fail are left out of the counts and returned in order
+func ScanCommits(cli *rpc.Client, from, to int64, parallel int) (map[string]*ValidatorLiveness, []FailedHeight) {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	var liveness = make(map[string]*ValidatorLiveness)
+	var mu sync.Mutex
+	var failed []FailedHeight
+
+	heights := make(chan int64)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for height := range heights {
+				validators, commit, err := heightCommit(cli, height)
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, FailedHeight{Height: height, Error: err.Error()})
+					mu.Unlock()
+					continue
+				}
+				for i, validator := range validators {
+					address := validator.Address.String()
+					v, ok := liveness[address]
+					if !ok {
+						v = &ValidatorLiveness{Address: address}
+						liveness[address] = v
+					}
+					if i < len(commit.Signatures) && !commit.Signatures[i].Absent() {
+						v.Signed++
+					} else {
+						v.Missed++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for height := from; height <= to; height++ {
+		heights <- height
+	}
+	close(heights)
+	wg.Wait()
+
+	for _, v := range liveness {
+		if total := v.Signed + v.Missed; total > 0 {
+			v.Uptime = float64(v.Signed) / float64(total)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Height < failed[j].Height })
+	return liveness, failed
+}
+
+// heightCommit the validator set of height and the commit it signed, in the same order
+func heightCommit(cli *rpc.Client, height int64) ([]*tmTypes.Validator, *tmTypes.Commit, error) {
+	commit, err := cli.Commit(height)
+	if err != nil {
+		return nil, nil, err
+	}
+	validators, err := validatorSet(cli, height)
+	if err != nil {
+		return nil, nil, err
+	}
+	return validators, commit.SignedHeader.Commit, nil
+}
+
+// validatorSet every validator of height, across pages
+func validatorSet(cli *rpc.Client, height int64) ([]*tmTypes.Validator, error) {
+	var validators []*tmTypes.Validator
+	const perPage = 100
+	for page := 1; ; page++ {
+		result, err := cli.Validators(height, page, perPage)
+		// a page past the end is an error, not an empty page
+		if err != nil && page > 1 && strings.Contains(err.Error(), "page should be within") {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		validators = append(validators, result.Validators...)
+		if len(result.Validators) < perPage {
+			break
+		}
+	}
+	return validators, nil
+}
+
+func fillSlashingInfo(cli *rpc.Client, liveness map[string]*ValidatorLiveness) error {
+	cdc := app.MakeCodec()
+	// validators are returned with bech32 consensus public keys
+	prefix, err := client.NewFastClient(cdc, cli.Remote).AddressPrefix()
+	if err != nil {
+		return err
+	}
+	common.SetGlobalBech32Prefix(prefix)
+
+	data, err := cdc.MarshalJSON(slashing.NewQuerySigningInfosParams(1, 1000))
+	if err != nil {
+		return err
+	}
+	res, err := cli.ABCIQuery(fmt.Sprintf("custom/%s/%s", slashing.QuerierRoute, slashing.QuerySigningInfos), data)
+	if err != nil {
+		return err
+	}
+	var signingInfos []slashing.ValidatorSigningInfo
+	if err = cdc.UnmarshalJSON(res.Response.Value, &signingInfos); err != nil {
+		return err
+	}
+	for _, info := range signingInfos {
+		address := strings.ToUpper(hex.EncodeToString(info.Address))
+		v, ok := liveness[address]
+		if !ok {
+			v = &ValidatorLiveness{Address: address}
+			liveness[address] = v
+		}
+		v.Tombstoned = info.Tombstoned
+		v.MissedCounter = info.MissedBlocksCounter
+		v.JailedUntil = info.JailedUntil
+	}
+
+	for _, status := range []string{"Bonded", "Unbonding", "Unbonded"} {
+		data, err := cdc.MarshalJSON(staking.NewQueryValidatorsParams(1, 1000, status))
+		if err != nil {
+			return err
+		}
+		res, err := cli.ABCIQuery(fmt.Sprintf("custom/%s/%s", staking.QuerierRoute, staking.QueryValidators), data)
+		if err != nil {
+			return err
+		}
+		var validators []staking.Validator
+		if err = cdc.UnmarshalJSON(res.Response.Value, &validators); err != nil {
+			return err
+		}
+		for _, validator := range validators {
+			v, ok := liveness[validator.ConsPubKey.Address().String()]
+			if !ok {
+				continue
+			}
+			v.Operator = validator.OperatorAddress.String()
+			v.Jailed = validator.Jailed
+		}
+	}
+	return nil
+}
+
+func sortLiveness(list []*ValidatorLiveness, by string) error {
+	var less func(a, b *ValidatorLiveness) bool
+	switch by {
+	case "missed":
+		less = func(a, b *ValidatorLiveness) bool { return a.Missed > b.Missed }
+	case "signed":
+		less = func(a, b *ValidatorLiveness) bool { return a.Signed > b.Signed }
+	case "uptime":
+		less = func(a, b *ValidatorLiveness) bool { return a.Uptime < b.Uptime }
+	case "node":
+		less = func(a, b *ValidatorLiveness) bool { return a.Node < b.Node }
+	case "address":
+		less = func(a, b *ValidatorLiveness) bool { return a.Address < b.Address }
+	default:
+		return fmt.Errorf("unknown sort: %s", by)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if less(list[i], list[j]) != less(list[j], list[i]) {
+			return less(list[i], list[j])
+		}
+		return list[i].Address < list[j].Address
+	})
+	return nil
+}
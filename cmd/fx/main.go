@@ -8,7 +8,10 @@ import (
 	"fx-tools/aws"
 	"fx-tools/batch"
 	"fx-tools/chain"
+	"fx-tools/chaos"
 	"fx-tools/cmd"
+	"fx-tools/docker"
+	"fx-tools/fleet"
 
 	"github.com/spf13/cobra"
 )
@@ -21,9 +24,12 @@ func main() {
 		PersistentPreRunE: cmd.BindFlagsToViper,
 	}
 	rootCmd.PersistentFlags().Bool("debug", false, "")
+	rootCmd.PersistentFlags().String("profile", "", "aws shared config profile, [aws] profile in config.toml by default")
+	rootCmd.PersistentFlags().String("region", "", "aws region, [aws] region in config.toml, then AWS_REGION, then "+aws.DefRegion)
 
 	rootCmd.AddCommand(
 		aws.NewAwsCmd(),
+		docker.NewDockerCmd(),
 		chain.NewChainCmd(),
 		chain.NewDeployChainCmd(),
 		cmd.NewListenCmd(),
@@ -35,6 +41,12 @@ func main() {
 		cmd.NewAccountCmd(),
 		cmd.NewTxCmd(),
 		cmd.NewDoctorCmd(),
+		cmd.NewNetworkCmd(),
+		cmd.NewSSHCmd(),
+		fleet.NewExecCmd(),
+		fleet.NewCpCmd(),
+		fleet.NewLogsCmd(),
+		chaos.NewChaosCmd(),
 		debug.NewUpdateNodeLogLevel(),
 		debug.NewClearLog(),
 		debug.NewDFH(),
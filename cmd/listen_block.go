@@ -8,14 +8,12 @@ import (
 	"syscall"
 	"time"
 
-	"hub/client"
 	"hub/logger"
 
+	"fx-tools/rpc"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/tendermint/go-amino"
-	coreTypes "github.com/tendermint/tendermint/rpc/core/types"
-	tmTypes "github.com/tendermint/tendermint/types"
 )
 
 func NewListenCmd() *cobra.Command {
@@ -43,22 +41,16 @@ func listenNewBlockV2(url string, times time.Duration, num int) error {
 	var sigs = make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-	cdc := amino.NewCodec()
-	tmTypes.RegisterEventDatas(cdc)
-	cdc.Seal()
-
 	ctx, cancel := context.WithCancel(context.Background())
-	ws, err := client.NewWsClient(cdc, fmt.Sprintf("%s/websocket", url))
-	if err != nil {
-		return err
-	}
-
-	var responsesCh = make(chan client.RPCResponse, 1024)
-	query := tmTypes.EventQueryNewBlock.String()
-	_, err = ws.Subscribe(ctx, query, responsesCh)
-	if err != nil {
-		return err
+	defer cancel()
+	sub := rpc.NewBlockSubscription(url)
+	sub.OnGap = func(from, to int64) {
+		logger.L.Warnf("missed heights %d - %d, fetching them", from, to)
 	}
+	var blocks = make(chan rpc.NewBlock, 1024)
+	go func() {
+		_ = sub.Run(ctx, blocks)
+	}()
 
 	var blockTxs = make([]int64, 0)
 	var blockTimes = make([]time.Time, 0)
@@ -66,27 +58,21 @@ func listenNewBlockV2(url string, times time.Duration, num int) error {
 	tick := time.Tick(times)
 	for {
 		select {
-		case resp := <-responsesCh:
-			if resp.Error != nil {
-				logger.L.Errorf("response code: %d, data: %s, msg: %s", resp.Error.Code, resp.Error.Data, resp.Error.Message)
-				continue
-			}
-			var resultEvent coreTypes.ResultEvent
-			err := cdc.UnmarshalJSON(resp.Result, &resultEvent)
-			if err != nil {
-				logger.L.Errorf("failed to unmarshal response err: %s", err)
-				continue
-			}
-			eventBlock, ok := resultEvent.Data.(tmTypes.EventDataNewBlock)
-			if !ok {
+		case newBlock := <-blocks:
+			block := newBlock.Block
+			if newBlock.Backfill {
+				logger.L.Infof("%s ，: %d，: %d (backfill)\n",
+					block.Time.Format("2006-01-02 15:04:05"), block.Height, len(block.Txs))
+				// the receive times around a gap say nothing about the block time
+				blockTxs, blockTimes = blockTxs[:0], blockTimes[:0]
 				continue
 			}
 
 			logger.L.Infof("%s ，: %d，: %d \n",
-				eventBlock.Block.Time.Format("2006-01-02 15:04:05"),
-				eventBlock.Block.Height, len(eventBlock.Block.Txs))
+				block.Time.Format("2006-01-02 15:04:05"),
+				block.Height, len(block.Txs))
 
-			blockTxs = append(blockTxs, int64(len(eventBlock.Block.Txs)))
+			blockTxs = append(blockTxs, int64(len(block.Txs)))
 			//blockTimes = append(blockTimes, header.Header.Time)
 			blockTimes = append(blockTimes, time.Now())
 
@@ -106,13 +92,8 @@ func listenNewBlockV2(url string, times time.Duration, num int) error {
 				aveNum, aveTime/float64(time.Second), aveNum, aveTxs,
 				float64(aveTxs)/(aveTime/float64(time.Millisecond*1000)))
 
-		case <-ws.ExitCh():
-			logger.L.Errorf("，")
-			return nil
-
 		case <-sigs:
 			logger.L.Infof("Closing ... ")
-			ws.Close()
 			cancel()
 			time.Sleep(300 * time.Millisecond)
 			return nil
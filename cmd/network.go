@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"fx-tools/aws"
+	"fx-tools/inventory"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewNetworkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "network",
+		Short:   "manage the node inventory of a network",
+		Example: "fx network --help",
+	}
+	cmd.PersistentFlags().String("network", "", "network name")
+	_ = cmd.MarkPersistentFlagRequired("network")
+	cmd.AddCommand(
+		NewNetworkListCmd(),
+		NewNetworkAddNodeCmd(),
+		NewNetworkRemoveNodeCmd(),
+		NewNetworkImportCmd(),
+	)
+	return cmd
+}
+
+func NewNetworkListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Example: "fx network list --network local",
+		RunE: func(*cobra.Command, []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("network: %s, provider: %s, chain id: %s\n", network.Name, network.Provider, network.ChainID)
+			for _, node := range network.Nodes {
+				fmt.Printf("name: %s, role: %s, publicIP: %s, privateIP: %s, docker: %s, container: %s, rpc: %s\n",
+					node.Name, node.Role, node.PublicIP, node.PrivateIP, node.DockerEndpoint(), node.ContainerName(), node.RPC())
+			}
+			fmt.Printf("Total: %d\n", len(network.Nodes))
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewNetworkAddNodeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "add",
+		Example: "fx network add --network local --provider docker --name node0 --public_ip 127.0.0.1 --private_ip 172.17.0.2 --docker_host unix:///var/run/docker.sock --container fx-chain-0 --rpc_port 26657",
+		Args:    cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			network, err := inventory.LoadOrNew(viper.GetString("network"), viper.GetString("provider"))
+			if err != nil {
+				return err
+			}
+			node := inventory.Node{
+				Name:       viper.GetString("name"),
+				Role:       viper.GetString("role"),
+				PublicIP:   viper.GetString("public_ip"),
+				PrivateIP:  viper.GetString("private_ip"),
+				DockerHost: viper.GetString("docker_host"),
+				Container:  viper.GetString("container"),
+				RPCPort:    viper.GetUint("rpc_port"),
+			}
+			if node.PrivateIP == "" {
+				node.PrivateIP = node.PublicIP
+			}
+			if path := viper.GetString("ssh_key"); path != "" {
+				// copied into the key dir of the network, the original may be moved
+				key, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				if node.SSHKey, err = inventory.SaveKey(network.Name, node.Name, node.PublicIP, key); err != nil {
+					return err
+				}
+			}
+			network.AddNode(node)
+			return network.Save()
+		},
+	}
+	cmd.Flags().String("provider", inventory.ProviderAWS, "aws or docker, only used by a new network")
+	cmd.Flags().String("name", "", "node name")
+	cmd.Flags().String("role", inventory.RoleValidator, "validator, normal, seed or sentry")
+	cmd.Flags().String("public_ip", "", "")
+	cmd.Flags().String("private_ip", "", "defaults to the public IP")
+	cmd.Flags().String("docker_host", "", "defaults to tcp://<public_ip>:2376")
+	cmd.Flags().String("container", inventory.DefContainer, "")
+	cmd.Flags().Uint("rpc_port", inventory.DefRPCPort, "")
+	cmd.Flags().String("ssh_key", "", "PEM private key of the instance, e.g. an old ./keys/<ip>.pem")
+	_ = cmd.MarkFlagRequired("name")
+	_ = cmd.MarkFlagRequired("public_ip")
+	return cmd
+}
+
+func NewNetworkRemoveNodeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "rm",
+		Example: "fx network rm --network local node0",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			for _, name := range args {
+				if !network.RemoveNode(name) {
+					return fmt.Errorf("node %s not found in network %s", name, network.Name)
+				}
+			}
+			return network.Save()
+		},
+	}
+	return cmd
+}
+
+func NewNetworkImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "import",
+		Short:   "import the aws stacks whose name contains grep",
+		Example: "fx network import --network test --grep fx-chain-jack",
+		RunE: func(*cobra.Command, []string) error {
+			awsCli, err := aws.NewDefAWSClient()
+			if err != nil {
+				return err
+			}
+			stacksSummaries, err := aws.ListCreateCompleteStacks(awsCli)
+			if err != nil {
+				return err
+			}
+			network, err := inventory.LoadOrNew(viper.GetString("network"), inventory.ProviderAWS)
+			if err != nil {
+				return err
+			}
+			for _, summaries := range stacksSummaries {
+				stackName := *summaries.StackName
+				if !strings.Contains(stackName, viper.GetString("grep")) {
+					continue
+				}
+				publicIP, privateIP, instanceId, err := aws.GetCfStackIP(awsCli, stackName)
+				if err != nil {
+					return err
+				}
+				role := inventory.RoleValidator
+				if strings.Contains(stackName, "-normal-") {
+					role = inventory.RoleNormal
+				}
+				node := inventory.Node{
+					Name:       stackName,
+					Role:       role,
+					PublicIP:   publicIP,
+					PrivateIP:  privateIP,
+					StackName:  stackName,
+					InstanceID: instanceId,
+				}
+				// the keys the debug commands used to read
+				if key, err := ioutil.ReadFile(filepath.Join("./keys", publicIP+".pem")); err == nil {
+					if node.SSHKey, err = inventory.SaveKey(network.Name, stackName, publicIP, key); err != nil {
+						return err
+					}
+				}
+				network.AddNode(node)
+				fmt.Printf("stackName: %s, role: %s, publicIP: %s, privateIP: %s\n", stackName, role, publicIP, privateIP)
+			}
+			return network.Save()
+		},
+	}
+	cmd.Flags().String("grep", "", "search about")
+	_ = cmd.MarkFlagRequired("grep")
+	return cmd
+}
@@ -1,60 +1,131 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"fx-tools/inventory"
+
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
 	config2 "github.com/prometheus/prometheus/discovery/config"
-	"github.com/prometheus/prometheus/discovery/targetgroup"
+	"github.com/prometheus/prometheus/discovery/file"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	JobChain        = "fx-chain"
+	JobCollector    = "fx-collector"
+	JobNodeExporter = "node-exporter"
+)
+
 func main() {
 	version := flag.Bool("version", false, "print version")
+	configFile := flag.String("config", "/prometheus/prometheus.yml", "prometheus config file")
+	rulesFile := flag.String("rules", "/prometheus/rules.yml", "alert rules file, written with the default rules unless it exists")
+	targetsDir := flag.String("targets", "/prometheus/targets", "file_sd_configs directory, one <job>.json per job")
+	collectors := flag.String("collector", "", "comma separated host:port of fx collectors")
+	nodeExporter := flag.Bool("node_exporter", false, "also scrape node-exporter on every node ip")
 	flag.Parse()
 
 	if *version {
-		fmt.Println("Version:", "v0.0.1")
+		fmt.Println("Version:", "v0.0.2")
 		return
 	}
 
+	if err := writeConfig(*configFile, *rulesFile, *targetsDir); err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*rulesFile); os.IsNotExist(err) {
+		if err = ioutil.WriteFile(*rulesFile, []byte(defaultRules), 0644); err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// the node ips on the command line are the initial targets, `fx prom targets` replaces them without a restart
+	var targets = map[string][]inventory.TargetGroup{JobChain: nil, JobCollector: nil, JobNodeExporter: nil}
+	for _, ip := range flag.Args() {
+		targets[JobChain] = append(targets[JobChain], inventory.TargetGroup{Targets: []string{fmt.Sprintf("%s:%d", ip, inventory.DefPrometheusPort)}})
+		if *nodeExporter {
+			targets[JobNodeExporter] = append(targets[JobNodeExporter], inventory.TargetGroup{Targets: []string{fmt.Sprintf("%s:%d", ip, inventory.DefNodeExporterPort)}})
+		}
+	}
+	for _, collector := range strings.Split(*collectors, ",") {
+		if collector != "" {
+			targets[JobCollector] = append(targets[JobCollector], inventory.TargetGroup{Targets: []string{collector}})
+		}
+	}
+	if err := writeTargets(*targetsDir, targets); err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+}
+
+func writeConfig(configFile, rulesFile, targetsDir string) error {
 	defCfg := config.Config{
 		GlobalConfig: config.GlobalConfig{EvaluationInterval: model.Duration(1 * time.Second)},
+		RuleFiles:    []string{rulesFile},
 	}
-
-	for i, ip := range flag.Args() {
+	for _, job := range []struct {
+		name     string
+		interval time.Duration
+	}{
+		{JobChain, 1 * time.Second},
+		{JobCollector, 1 * time.Second},
+		{JobNodeExporter, 15 * time.Second},
+	} {
 		defCfg.ScrapeConfigs = append(defCfg.ScrapeConfigs, &config.ScrapeConfig{
-			JobName:         fmt.Sprintf("fx-chain-%s-%d", ip, i),
+			JobName:         job.name,
 			HonorTimestamps: true,
-			ScrapeInterval:  model.Duration(1 * time.Second),
-			ScrapeTimeout:   model.Duration(1 * time.Second),
+			ScrapeInterval:  model.Duration(job.interval),
+			ScrapeTimeout:   model.Duration(job.interval),
 			MetricsPath:     "/metrics",
 			Scheme:          "http",
 			ServiceDiscoveryConfig: config2.ServiceDiscoveryConfig{
-				StaticConfigs: []*targetgroup.Group{
+				FileSDConfigs: []*file.SDConfig{
 					{
-						Targets: []model.LabelSet{
-							{
-								model.AddressLabel: model.LabelValue(fmt.Sprintf("%s:26660", ip)),
-							},
-						},
+						Files:           []string{filepath.Join(targetsDir, job.name+".json")},
+						RefreshInterval: model.Duration(10 * time.Second),
 					},
 				},
 			},
 		})
 	}
-	if out, err := yaml.Marshal(defCfg); err != nil {
-		println(err.Error())
-		os.Exit(1)
-	} else {
-		if err := ioutil.WriteFile("/prometheus/prometheus.yml", out, os.ModePerm); err != nil {
-			println(err.Error())
-			os.Exit(1)
+	out, err := yaml.Marshal(defCfg)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(configFile, out, 0644)
+}
+
+// writeTargets writes the target files that do not exist yet, a restart keeps the regenerated ones
+func writeTargets(dir string, targets map[string][]inventory.TargetGroup) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for job, groups := range targets {
+		name := filepath.Join(dir, job+".json")
+		if _, err := os.Stat(name); err == nil {
+			continue
+		}
+		if groups == nil {
+			groups = []inventory.TargetGroup{}
+		}
+		data, err := json.MarshalIndent(groups, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(name, data, 0644); err != nil {
+			return err
 		}
 	}
+	return nil
 }
@@ -0,0 +1,41 @@
+package main
+
+// defaultRules alerts on the tendermint metrics of the nodes and the fx collector metrics
+const defaultRules = `groups:
+  - name: fx-chain
+    rules:
+      - alert: ChainHalted
+        expr: max by (network) (increase(tendermint_consensus_height[2m])) == 0
+        for: 1m
+        labels:
+          severity: critical
+        annotations:
+          summary: "no new block for 3 minutes"
+      - alert: ValidatorMissingBlocks
+        expr: increase(fx_tools_validator_missed_blocks_total[5m]) > 10
+        labels:
+          severity: warning
+        annotations:
+          summary: "validator {{ $labels.validator }} missed {{ $value }} blocks in 5 minutes"
+      - alert: ValidatorsMissing
+        expr: tendermint_consensus_missing_validators > 0
+        for: 5m
+        labels:
+          severity: warning
+        annotations:
+          summary: "{{ $value }} validators missing from the last commits seen by {{ $labels.node }}"
+      - alert: MempoolGrowing
+        expr: deriv(tendermint_mempool_size[10m]) > 0 and tendermint_mempool_size > 1000
+        for: 10m
+        labels:
+          severity: warning
+        annotations:
+          summary: "mempool of {{ $labels.node }} over 1000 txs and growing by {{ $value | humanize }} txs/s"
+      - alert: PeerCountLow
+        expr: tendermint_p2p_peers < 2
+        for: 2m
+        labels:
+          severity: warning
+        annotations:
+          summary: "{{ $labels.node }} has {{ $value }} peers"
+`
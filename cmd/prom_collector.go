@@ -3,18 +3,22 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"hub/client"
 	"hub/logger"
 
+	"fx-tools/rpc"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"github.com/tendermint/go-amino"
-	coreTypes "github.com/tendermint/tendermint/rpc/core/types"
 	tmTypes "github.com/tendermint/tendermint/types"
 )
 
@@ -22,118 +26,304 @@ func NewPromCollectorCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "collector",
 		Short:   "",
-		Example: "fx collector --ip 127.0.0.1",
-		RunE: func(c *cobra.Command, args []string) error {
-			startPrometheusServer()
-			url := fmt.Sprintf("http://%s:%d", viper.GetString("ip"), viper.GetUint("port"))
-			return listenChainNewBlock(url)
+		Example: "fx collector --node val-0=10.0.0.1 --node 10.0.0.2:26657 --listen :8080",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nodes, err := cmd.Flags().GetStringArray("node")
+			if err != nil {
+				return err
+			}
+			if len(nodes) == 0 {
+				nodes = []string{fmt.Sprintf("%s:%d", viper.GetString("ip"), viper.GetUint("port"))}
+			}
+			var targets []collectorTarget
+			for _, node := range nodes {
+				target, err := parseCollectorTarget(node, viper.GetUint("port"))
+				if err != nil {
+					return err
+				}
+				targets = append(targets, target)
+			}
+
+			metrics := newCollectorMetrics()
+			srv, serveErr, err := startPrometheusServer(viper.GetString("listen"), metrics.registry)
+			if err != nil {
+				return err
+			}
+			defer srv.Close()
+
+			// the collectors run until the process exits
+			for _, target := range targets {
+				go metrics.collect(target, viper.GetDuration("max_backoff"))
+			}
+			return <-serveErr
 		},
 	}
+	cmd.Flags().StringArray("node", []string{}, "[label=]ip[:port] or [label=]http://host:port, repeatable, the label defaults to the host")
 	cmd.Flags().Uint("port", 26657, "RPC")
-	cmd.Flags().String("ip", "127.0.0.1", "IP")
+	cmd.Flags().String("ip", "127.0.0.1", "IP, when no --node is given")
+	cmd.Flags().String("listen", ":8080", "Address to serve /metrics")
+	cmd.Flags().Duration("max_backoff", time.Minute, "longest wait between reconnects")
 	return cmd
 }
 
-func listenChainNewBlock(url string) error {
-	logger.L.Infof("=====> : [%s] ... ...", url)
-
-	cdc := amino.NewCodec()
-	tmTypes.RegisterEventDatas(cdc)
-	cdc.Seal()
+type collectorTarget struct {
+	Label string
+	URL   string
+}
 
-	ws, err := client.NewWsClient(cdc, fmt.Sprintf("%s/websocket", url))
+func parseCollectorTarget(node string, defPort uint) (collectorTarget, error) {
+	var target collectorTarget
+	if i := strings.Index(node, "="); i > 0 {
+		target.Label, node = node[:i], node[i+1:]
+	}
+	if !strings.Contains(node, "://") {
+		node = "http://" + node
+	}
+	u, err := url.Parse(node)
 	if err != nil {
-		return err
+		return target, err
+	}
+	if u.Port() == "" {
+		u.Host = fmt.Sprintf("%s:%d", u.Hostname(), defPort)
 	}
+	target.URL = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	if target.Label == "" {
+		target.Label = u.Hostname()
+	}
+	return target, nil
+}
 
-	var responsesCh = make(chan client.RPCResponse, 1024)
-	query := tmTypes.EventQueryNewBlock.String()
-	_, err = ws.Subscribe(context.Background(), query, responsesCh)
-	if err != nil {
-		return err
+// collect follows the blocks of the node until the process exits
+func (m *collectorMetrics) collect(target collectorTarget, maxBackoff time.Duration) {
+	logger.L.Infof("=====> : [%s] ... ...", target.URL)
+	cli := rpc.NewClient(target.URL)
+
+	// the chain id label needs the node up once
+	backoff := time.Second
+	status, err := cli.Status()
+	for err != nil {
+		logger.L.Errorf("node %s: %s, retry in %s", target.Label, err.Error(), backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		status, err = cli.Status()
+	}
+	labels := prometheus.Labels{"chain_id": status.NodeInfo.Network, "node": target.Label}
+	m.setHeight(labels, status.SyncInfo.LatestBlockHeight)
+
+	sub := rpc.NewBlockSubscription(target.URL)
+	sub.MaxBackoff = maxBackoff
+	sub.OnConnect = func() {
+		m.up.With(labels).Set(1)
+	}
+	sub.OnDisconnect = func(error) {
+		m.up.With(labels).Set(0)
+		m.reconnects.With(labels).Inc()
+	}
+	sub.OnGap = func(from, to int64) {
+		logger.L.Warnf("node %s: missed heights %d - %d", target.Label, from, to)
+		m.blockGaps.With(labels).Inc()
+		m.blockGapHeights.With(labels).Add(float64(to - from + 1))
+	}
+	sub.OnUnfilled = func(from, to int64) {
+		logger.L.Warnf("node %s: heights %d - %d not backfilled", target.Label, from, to)
+		m.unfilledHeights.With(labels).Add(float64(to - from + 1))
 	}
+	var blocks = make(chan rpc.NewBlock, 1024)
+	go func() {
+		_ = sub.Run(context.Background(), blocks)
+	}()
 
 	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	var lastHeight int64
 	var lastBlockTime time.Time
 	for {
 		select {
-		case resp := <-responsesCh:
-			if resp.Error != nil {
-				logger.L.Errorf("response code: %d, data: %s, msg: %s", resp.Error.Code, resp.Error.Data, resp.Error.Message)
-				continue
+		case newBlock := <-blocks:
+			block := newBlock.Block
+			if newBlock.Backfill {
+				m.backfilledBlocks.With(labels).Inc()
+			} else {
+				m.blockNumTxs.With(labels).Set(float64(len(block.Txs)))
+				// the interval is only meaningful between blocks received one after the other
+				if lastHeight > 0 && block.Height == lastHeight+1 {
+					m.blockInterval.With(labels).Set(time.Now().Sub(lastBlockTime).Seconds())
+				}
+				lastBlockTime = time.Now()
 			}
-			var resultEvent coreTypes.ResultEvent
-			err := cdc.UnmarshalJSON(resp.Result, &resultEvent)
+			lastHeight = block.Height
+			m.setHeight(labels, block.Height)
+			m.observeBlock(cli, labels, block)
+		case <-ticker.C:
+			res, err := cli.NumUnconfirmedTxs()
 			if err != nil {
-				logger.L.Errorf("failed to unmarshal response err: %s", err)
-				continue
-			}
-			eventBlock, ok := resultEvent.Data.(tmTypes.EventDataNewBlock)
-			if !ok {
+				logger.L.Debugf("node %s GetNumUnconfirmedTxs err: %s", target.Label, err)
 				continue
 			}
+			m.unconfirmedNumTxs.With(labels).Set(float64(res.Total))
+			m.unconfirmedTxsBytes.With(labels).Set(float64(res.TotalBytes))
+		}
+	}
+}
 
-			blockNumTxs.Set(float64(len(eventBlock.Block.Txs)))
-			realityBlockTime.Set(time.Now().Sub(lastBlockTime).Seconds())
+// observeBlock the metrics of a block that are not in the new block event itself
+func (m *collectorMetrics) observeBlock(cli *rpc.Client, labels prometheus.Labels, block *tmTypes.Block) {
+	m.blockSizeBytes.With(labels).Set(float64(block.Size()))
+	m.validatorProposed.With(withLabel(labels, "validator", block.ProposerAddress.String())).Inc()
 
-			lastBlockTime = time.Now()
-		case <-ticker.C:
-			res, err := ws.NumUnconfirmedTxs()
-			if err != nil {
-				logger.L.Errorf("GetNumUnconfirmedTxs err: %s", err)
-				continue
+	// the last commit is signed by the validator set of the previous height
+	if block.LastCommit != nil && block.Height > 1 {
+		validators, err := validatorSet(cli, block.Height-1)
+		if err != nil {
+			logger.L.Warnf("height %d validators error: %s", block.Height-1, err.Error())
+		}
+		for i, validator := range validators {
+			validatorLabels := withLabel(labels, "validator", validator.Address.String())
+			if i < len(block.LastCommit.Signatures) && !block.LastCommit.Signatures[i].Absent() {
+				m.validatorSigned.With(validatorLabels).Inc()
+			} else {
+				m.validatorMissed.With(validatorLabels).Inc()
 			}
-			unconfirmedNumTxs.Set(float64(res.Total))
+		}
+	}
+
+	results, err := cli.BlockResults(block.Height)
+	if err != nil {
+		logger.L.Warnf("height %d block results error: %s", block.Height, err.Error())
+		return
+	}
+	var gasUsed, gasWanted int64
+	for _, tx := range results.TxsResults {
+		gasUsed += tx.GasUsed
+		gasWanted += tx.GasWanted
+		txLabels := withLabel(labels, "codespace", tx.Codespace)
+		txLabels["code"] = strconv.FormatUint(uint64(tx.Code), 10)
+		m.txResults.With(txLabels).Inc()
+	}
+	m.blockGasUsed.With(labels).Set(float64(gasUsed))
+	m.blockGasWanted.With(labels).Set(float64(gasWanted))
+}
 
-		case <-ws.ExitCh():
-			logger.L.Errorf("，")
-			return nil
+// setHeight records the height of a node and the lag of every node behind the highest one
+func (m *collectorMetrics) setHeight(labels prometheus.Labels, height int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.heights[labels["node"]] = nodeHeight{labels: labels, height: height}
+	m.blockHeight.With(labels).Set(float64(height))
+
+	var maxHeight int64
+	for _, node := range m.heights {
+		if node.height > maxHeight {
+			maxHeight = node.height
 		}
 	}
+	for _, node := range m.heights {
+		m.heightLag.With(node.labels).Set(float64(maxHeight - node.height))
+	}
 }
 
-var (
-	realityBlockTime = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "fx",
-		Subsystem: "tools",
-		Name:      "block_interval_seconds",
-		Help:      "",
-	})
-
-	blockNumTxs = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "fx",
-		Subsystem: "tools",
-		Name:      "block_num_txs",
-		Help:      "",
-	})
-
-	unconfirmedNumTxs = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: "fx",
-		Subsystem: "tools",
-		Name:      "unconfirmed_num_txs",
-		Help:      "",
-	})
-)
+func withLabel(labels prometheus.Labels, name, value string) prometheus.Labels {
+	res := prometheus.Labels{name: value}
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
+
+type nodeHeight struct {
+	labels prometheus.Labels
+	height int64
+}
+
+type collectorMetrics struct {
+	registry *prometheus.Registry
+
+	mu      sync.Mutex
+	heights map[string]nodeHeight
+
+	up                  *prometheus.GaugeVec
+	reconnects          *prometheus.CounterVec
+	blockGaps           *prometheus.CounterVec
+	blockGapHeights     *prometheus.CounterVec
+	unfilledHeights     *prometheus.CounterVec
+	backfilledBlocks    *prometheus.CounterVec
+	blockHeight         *prometheus.GaugeVec
+	heightLag           *prometheus.GaugeVec
+	blockInterval       *prometheus.GaugeVec
+	blockNumTxs         *prometheus.GaugeVec
+	unconfirmedNumTxs   *prometheus.GaugeVec
+	unconfirmedTxsBytes *prometheus.GaugeVec
+	blockSizeBytes      *prometheus.GaugeVec
+	blockGasUsed        *prometheus.GaugeVec
+	blockGasWanted      *prometheus.GaugeVec
+	txResults           *prometheus.CounterVec
+	validatorSigned     *prometheus.CounterVec
+	validatorMissed     *prometheus.CounterVec
+	validatorProposed   *prometheus.CounterVec
+}
+
+func newCollectorMetrics() *collectorMetrics {
+	nodeLabels := []string{"chain_id", "node"}
+	validatorLabels := []string{"chain_id", "node", "validator"}
+	gauge := func(name, help string, labels []string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: "fx", Subsystem: "tools", Name: name, Help: help}, labels)
+	}
+	counter := func(name, help string, labels []string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "fx", Subsystem: "tools", Name: name, Help: help}, labels)
+	}
 
-func startPrometheusServer() {
-	registerer := prometheus.DefaultRegisterer
-	registerer.MustRegister(realityBlockTime)
-	registerer.MustRegister(blockNumTxs)
-	registerer.MustRegister(unconfirmedNumTxs)
+	m := &collectorMetrics{
+		registry: prometheus.NewRegistry(),
+		heights:  make(map[string]nodeHeight),
+
+		up:                  gauge("node_up", "1 while the websocket subscription to the node is open", nodeLabels),
+		reconnects:          counter("node_reconnects_total", "", nodeLabels),
+		blockGaps:           counter("block_gaps_total", "times new block events were missed", nodeLabels),
+		blockGapHeights:     counter("block_gap_heights_total", "heights missed by the new block events", nodeLabels),
+		unfilledHeights:     counter("block_unfilled_heights_total", "missed heights that could not be fetched by height", nodeLabels),
+		backfilledBlocks:    counter("backfilled_blocks_total", "missed blocks fetched by height", nodeLabels),
+		blockHeight:         gauge("block_height", "", nodeLabels),
+		heightLag:           gauge("block_height_lag", "blocks behind the highest node", nodeLabels),
+		blockInterval:       gauge("block_interval_seconds", "", nodeLabels),
+		blockNumTxs:         gauge("block_num_txs", "", nodeLabels),
+		unconfirmedNumTxs:   gauge("unconfirmed_num_txs", "", nodeLabels),
+		unconfirmedTxsBytes: gauge("unconfirmed_txs_bytes", "size of the mempool in bytes", nodeLabels),
+		blockSizeBytes:      gauge("block_size_bytes", "", nodeLabels),
+		blockGasUsed:        gauge("block_gas_used", "gas used by the txs of the block", nodeLabels),
+		blockGasWanted:      gauge("block_gas_wanted", "gas wanted by the txs of the block", nodeLabels),
+		txResults: counter("tx_results_total", "delivered txs by ABCI codespace and code, code 0 is success",
+			[]string{"chain_id", "node", "codespace", "code"}),
+		validatorSigned:   counter("validator_signed_blocks_total", "blocks whose last commit has the validator signature", validatorLabels),
+		validatorMissed:   counter("validator_missed_blocks_total", "blocks whose last commit misses the validator signature", validatorLabels),
+		validatorProposed: counter("validator_proposed_blocks_total", "", validatorLabels),
+	}
+	m.registry.MustRegister(m.up, m.reconnects, m.blockGaps, m.blockGapHeights, m.unfilledHeights, m.backfilledBlocks, m.blockHeight, m.heightLag, m.blockInterval, m.blockNumTxs,
+		m.unconfirmedNumTxs, m.unconfirmedTxsBytes, m.blockSizeBytes, m.blockGasUsed, m.blockGasWanted,
+		m.txResults, m.validatorSigned, m.validatorMissed, m.validatorProposed)
+	return m
+}
 
+// startPrometheusServer serves /metrics on listen, the channel gets the error that stopped serving
+func startPrometheusServer(listen string, registry *prometheus.Registry) (*http.Server, <-chan error, error) {
+	// listen before collecting, a port in use fails right away
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, nil, err
+	}
 	srv := &http.Server{
-		Addr: ":8080",
 		Handler: promhttp.InstrumentMetricHandler(
-			registerer, promhttp.HandlerFor(
-				prometheus.DefaultGatherer,
+			registry, promhttp.HandlerFor(
+				registry,
 				promhttp.HandlerOpts{MaxRequestsInFlight: 3},
 			),
 		),
 	}
+	serveErr := make(chan error, 1)
 	go func() {
-		logger.L.Infof("=====> prometheus gatherer running ... ...")
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			logger.L.Errorf("Prometheus HTTP server ListenAndServe err: %s", err)
-		}
+		logger.L.Infof("=====> prometheus gatherer running %s ... ...", listen)
+		serveErr <- srv.Serve(listener)
 	}()
+	return srv, serveErr, nil
 }
@@ -1,14 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"hub/logger"
 
 	"fx-tools/aws"
 	"fx-tools/docker"
+	"fx-tools/inventory"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,16 +27,33 @@ func NewStartPromServer() *cobra.Command {
 		Example: "fx prom --ip 127.0.0.1 --node <chain ip>",
 		RunE: func(*cobra.Command, []string) (err error) {
 			ip := viper.GetString("ip")
-			if err := docker.StartPrometheus(ip, viper.GetStringSlice("node")); err != nil {
+			args, err := promArgs()
+			if err != nil {
+				return err
+			}
+			if err := docker.StartPrometheus(ip, args); err != nil {
+				return err
+			}
+			if err := sendPromTargets(ip); err != nil {
 				return err
 			}
 			fmt.Printf(": http://%s:9090\n", ip)
+			if viper.GetBool("grafana") {
+				if err := docker.StartGrafana(ip, "http://127.0.0.1:9090"); err != nil {
+					return err
+				}
+				fmt.Printf("grafana: http://%s:3000\n", ip)
+			}
 			return nil
 		},
 	}
 	cmd.Flags().String("ip", "127.0.0.1", "IP")
 	cmd.PersistentFlags().StringSlice("node", []string{"127.0.0.1"}, "IP")
-	cmd.AddCommand(NewDeployPromCmd())
+	cmd.PersistentFlags().String("network", "", "scrape the nodes of this inventory network instead of --node")
+	cmd.PersistentFlags().Bool("grafana", true, "also start grafana with the fx dashboards next to prometheus")
+	cmd.PersistentFlags().StringSlice("collector", []string{}, "host:port of fx collectors")
+	cmd.PersistentFlags().Bool("node_exporter", true, "also scrape node-exporter on every node, the stacks run it")
+	cmd.AddCommand(NewDeployPromCmd(), NewPromTargetsCmd())
 	return cmd
 }
 
@@ -47,13 +70,164 @@ func NewDeployPromCmd() *cobra.Command {
 				logger.L.Errorf("new aws ec2 instance error: %s", err.Error())
 				return
 			}
-			if err = docker.StartPrometheus(publicIP, viper.GetStringSlice("node")); err != nil {
+			args, err := promArgs()
+			if err != nil {
+				return
+			}
+			if err = docker.StartPrometheus(publicIP, args); err != nil {
 				logger.L.Errorf("docker start prometheus error: %s", err.Error())
 				return
 			}
+			if err = sendPromTargets(publicIP); err != nil {
+				logger.L.Errorf("send prometheus targets error: %s", err.Error())
+				return
+			}
 			logger.L.Infof(": http://%s:9090", publicIP)
+			if viper.GetBool("grafana") {
+				if err = docker.StartGrafana(publicIP, "http://127.0.0.1:9090"); err != nil {
+					logger.L.Errorf("docker start grafana error: %s", err.Error())
+					return
+				}
+				logger.L.Infof("grafana: http://%s:3000", publicIP)
+			}
 			return
 		},
 	}
 	return cmd
 }
+
+// promArgs the arguments of the prometheus container, the scrape flags before the node ips
+func promArgs() ([]string, error) {
+	nodes, err := promNodes()
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if viper.GetBool("node_exporter") {
+		args = append(args, "--node_exporter")
+	}
+	if collectors := viper.GetStringSlice("collector"); len(collectors) > 0 {
+		args = append(args, "--collector", strings.Join(collectors, ","))
+	}
+	return append(args, nodes...), nil
+}
+
+// promNodes the node ips of --network, or --node
+func promNodes() ([]string, error) {
+	name := viper.GetString("network")
+	if name == "" {
+		return viper.GetStringSlice("node"), nil
+	}
+	network, err := inventory.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, group := range network.PromTargets(inventory.DefPrometheusPort) {
+		host, _, err := net.SplitHostPort(group.Targets[0])
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, host)
+	}
+	return ips, nil
+}
+
+func NewPromTargetsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "targets",
+		Short:   "regenerate the scrape targets of a running prometheus from the inventory, no restart needed",
+		Example: "fx prom targets --ip <prom ip> --network test --collector 10.0.0.5:8080 --node_exporter",
+		RunE: func(*cobra.Command, []string) error {
+			if viper.GetString("network") == "" {
+				return fmt.Errorf("--network is required")
+			}
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			files, err := PromTargetFiles(network, viper.GetStringSlice("collector"), viper.GetBool("node_exporter"))
+			if err != nil {
+				return err
+			}
+
+			if dir := viper.GetString("dir"); dir != "" {
+				if err = os.MkdirAll(dir, 0755); err != nil {
+					return err
+				}
+				for name, data := range files {
+					if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if err = copyPromTargets(viper.GetString("ip"), files); err != nil {
+				return err
+			}
+			logger.L.Infof("targets of %d nodes sent to prometheus on %s", len(network.Nodes), viper.GetString("ip"))
+			return nil
+		},
+	}
+	cmd.Flags().String("ip", "127.0.0.1", "IP of the prometheus host")
+	cmd.Flags().String("dir", "", "write the target files to this directory instead of the prometheus container")
+	return cmd
+}
+
+// sendPromTargets replaces the targets of the prometheus on ip with the labeled targets of --network,
+// the node ips given to the container carry no network, node or role label
+func sendPromTargets(ip string) error {
+	name := viper.GetString("network")
+	if name == "" {
+		return nil
+	}
+	network, err := inventory.Load(name)
+	if err != nil {
+		return err
+	}
+	files, err := PromTargetFiles(network, viper.GetStringSlice("collector"), viper.GetBool("node_exporter"))
+	if err != nil {
+		return err
+	}
+	return copyPromTargets(ip, files)
+}
+
+func copyPromTargets(ip string, files map[string][]byte) error {
+	cli, err := docker.NewCli(fmt.Sprintf("tcp://%s:2376", ip))
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return docker.CopyFiles(cli, "fx-prometheus", "/prometheus/targets", files)
+}
+
+// PromTargetFiles the file_sd_configs file of every prometheus job, as cmd/prom names them
+func PromTargetFiles(network *inventory.Network, collectors []string, nodeExporter bool) (map[string][]byte, error) {
+	var targets = map[string][]inventory.TargetGroup{
+		"fx-chain":      network.PromTargets(inventory.DefPrometheusPort),
+		"fx-collector":  {},
+		"node-exporter": {},
+	}
+	for _, collector := range collectors {
+		targets["fx-collector"] = append(targets["fx-collector"], inventory.TargetGroup{
+			Targets: []string{collector},
+			Labels:  map[string]string{"network": network.Name},
+		})
+	}
+	if nodeExporter {
+		targets["node-exporter"] = network.PromTargets(inventory.DefNodeExporterPort)
+	}
+
+	var files = make(map[string][]byte)
+	for job, groups := range targets {
+		if groups == nil {
+			groups = []inventory.TargetGroup{}
+		}
+		data, err := json.MarshalIndent(groups, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files[job+".json"] = data
+	}
+	return files, nil
+}
@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"hub/app"
 
@@ -44,9 +47,13 @@ func NewSeedCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			addrBookFile := filepath.Join(os.Getenv("HOME"), ".fx-seed-addr-book.json")
-			myLog.Info("addr book file", "path", addrBookFile)
-			if err = ioutil.WriteFile(addrBookFile, nodeKeyBts, os.ModePerm); err != nil {
+			nodeKeyFile := viper.GetString("node_key_file")
+			addrBookFile := viper.GetString("addr_book_file")
+			if nodeKeyFile == addrBookFile {
+				return fmt.Errorf("node key file and addr book file are the same: %s", nodeKeyFile)
+			}
+			myLog.Info("seed files", "node-key", nodeKeyFile, "addr-book", addrBookFile)
+			if err = ioutil.WriteFile(nodeKeyFile, nodeKeyBts, 0600); err != nil {
 				return err
 			}
 
@@ -57,50 +64,41 @@ func NewSeedCmd() *cobra.Command {
 			// TODO(roman) expose per-module log levels in the config
 			filteredLogger := log.NewFilter(myLog, log.AllowDebug())
 
-			protocolVersion := p2p.NewProtocolVersion(version.P2PProtocol, version.BlockProtocol, 0)
-
-			nodeInfo := p2p.DefaultNodeInfo{
-				ProtocolVersion: protocolVersion,
-				DefaultNodeID:   nodeKey.ID(),
-				ListenAddr:      listenAddress,
-				Network:         chainID,
-				Version:         "0.0.1",
-				Channels:        []byte{pex.PexChannel},
-				Moniker:         fmt.Sprintf("%s-seed", chainID),
-			}
-
-			addr, err := p2p.NewNetAddressString(p2p.IDAddressString(nodeInfo.DefaultNodeID, nodeInfo.ListenAddr))
+			node, err := newSeedNode(filteredLogger, cfg, nodeKey, chainID, listenAddress, addrBookFile, addrBookStrict, true)
 			if err != nil {
 				return err
 			}
+			sw, book := node.sw, node.book
 
-			transport := p2p.NewMultiplexTransport(nodeInfo, *nodeKey, p2p.MConnConfig(cfg))
-			if err := transport.Listen(*addr); err != nil {
-				panic(err)
-			}
-
-			book := pex.NewAddrBook(addrBookFile, addrBookStrict)
-			book.SetLogger(filteredLogger.With("module", "book"))
-
-			pexReactor := pex.NewReactor(book, &pex.ReactorConfig{
-				SeedMode: true,
-				// Seeds:    args.SeedConfig.Seeds,
-			})
-			pexReactor.SetLogger(filteredLogger.With("module", "pex"))
-
-			sw := p2p.NewSwitch(cfg, transport)
-			sw.SetLogger(filteredLogger.With("module", "switch"))
-			sw.SetNodeKey(nodeKey)
-			sw.AddReactor("pex", pexReactor)
+			metrics := newSeedMetrics(sw, book)
+			sw.AddReactor("pex", &seedReactor{Reactor: node.pex, metrics: metrics})
 
 			// last
-			sw.SetNodeInfo(nodeInfo)
+			sw.SetNodeInfo(node.nodeInfo)
 
 			err = sw.Start()
 			if err != nil {
 				return err
 			}
-			sw.Wait()
+
+			srv := startSeedHTTPServer(viper.GetString("http_laddr"), book, addrBookFile, metrics)
+			go func() {
+				myLog.Info("seed http running", "listen", srv.Addr)
+				if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+					myLog.Error("seed http server", "err", err)
+				}
+			}()
+
+			var sigs = make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			<-sigs
+			myLog.Info("Closing ... ")
+			_ = srv.Close()
+			// stopping the pex reactor stops the address book, which saves it
+			if err = sw.Stop(); err != nil {
+				myLog.Error("seed stop", "err", err)
+			}
+			book.Save()
 			return nil
 		}}
 	if !rootCmd.HasParent() {
@@ -112,10 +110,60 @@ func NewSeedCmd() *cobra.Command {
 	rootCmd.Flags().Uint("max_num_inbound_peers", 1000, "maximum number of inbound connections")
 	rootCmd.Flags().Uint("max_num_outbound_peers", 100, "maximum number of outbound connections")
 	rootCmd.Flags().Bool("addr_book_strict", false, "")
-	rootCmd.AddCommand(NewShowNodeId())
+	rootCmd.Flags().String("node_key_file", filepath.Join(os.Getenv("HOME"), ".fx-seed-node-key.json"), "")
+	rootCmd.Flags().String("addr_book_file", filepath.Join(os.Getenv("HOME"), ".fx-seed-addr-book.json"), "")
+	rootCmd.Flags().String("http_laddr", "0.0.0.0:26680", "Address to serve /peers and /metrics")
+	rootCmd.AddCommand(NewShowNodeId(), NewCrawlCmd())
 	return rootCmd
 }
 
+type seedNode struct {
+	nodeInfo p2p.DefaultNodeInfo
+	sw       *p2p.Switch
+	book     pex.AddrBook
+	pex      *pex.Reactor
+}
+
+// newSeedNode listens on listenAddress and prepares a switch speaking only pex,
+// the caller adds the pex reactor, possibly wrapped, and starts the switch
+func newSeedNode(logger log.Logger, cfg *config.P2PConfig, nodeKey *p2p.NodeKey, chainID, listenAddress, addrBookFile string, addrBookStrict, seedMode bool) (*seedNode, error) {
+	protocolVersion := p2p.NewProtocolVersion(version.P2PProtocol, version.BlockProtocol, 0)
+
+	nodeInfo := p2p.DefaultNodeInfo{
+		ProtocolVersion: protocolVersion,
+		DefaultNodeID:   nodeKey.ID(),
+		ListenAddr:      listenAddress,
+		Network:         chainID,
+		Version:         "0.0.1",
+		Channels:        []byte{pex.PexChannel},
+		Moniker:         fmt.Sprintf("%s-seed", chainID),
+	}
+
+	addr, err := p2p.NewNetAddressString(p2p.IDAddressString(nodeInfo.DefaultNodeID, nodeInfo.ListenAddr))
+	if err != nil {
+		return nil, err
+	}
+
+	transport := p2p.NewMultiplexTransport(nodeInfo, *nodeKey, p2p.MConnConfig(cfg))
+	if err := transport.Listen(*addr); err != nil {
+		return nil, err
+	}
+
+	book := pex.NewAddrBook(addrBookFile, addrBookStrict)
+	book.SetLogger(logger.With("module", "book"))
+
+	pexReactor := pex.NewReactor(book, &pex.ReactorConfig{
+		SeedMode: seedMode,
+		// Seeds:    args.SeedConfig.Seeds,
+	})
+	pexReactor.SetLogger(logger.With("module", "pex"))
+
+	sw := p2p.NewSwitch(cfg, transport)
+	sw.SetLogger(logger.With("module", "switch"))
+	sw.SetNodeKey(nodeKey)
+	return &seedNode{nodeInfo: nodeInfo, sw: sw, book: book, pex: pexReactor}, nil
+}
+
 func NewShowNodeId() *cobra.Command {
 	xcmd := &cobra.Command{
 		Use:     "id",
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fx-tools/inventory"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/p2p/pex"
+)
+
+type CrawlPeer struct {
+	ID     string `json:"id"`
+	Addr   string `json:"addr"`
+	Source string `json:"source,omitempty"`
+	Depth  int    `json:"depth"`
+
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"error_kind,omitempty"`
+	// Addrs the number of addresses the peer answered with
+	Addrs int `json:"addrs"`
+
+	Moniker    string `json:"moniker,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Network    string `json:"network,omitempty"`
+	Channels   string `json:"channels,omitempty"`
+	ListenAddr string `json:"listen_addr,omitempty"`
+	RPCAddr    string `json:"rpc_addr,omitempty"`
+}
+
+type CrawlReport struct {
+	ChainID string    `json:"chain_id"`
+	Seeds   []string  `json:"seeds"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+
+	Addresses      int            `json:"addresses"`
+	Reachable      int            `json:"reachable"`
+	Unreachable    int            `json:"unreachable"`
+	Nodes          int            `json:"nodes"`
+	ReachableNodes int            `json:"reachable_nodes"`
+	Versions       map[string]int `json:"versions"`
+	Errors         map[string]int `json:"errors"`
+	Peers          []*CrawlPeer   `json:"peers"`
+}
+
+func NewCrawlCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "crawl",
+		Short:   "crawl the p2p network from the seeds and report every reachable peer",
+		Example: "fx seed crawl --chain_id hub --seeds 8c5f...@1.2.3.4:26656 --output crawl.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			myLog := log.NewTMLogger(log.NewSyncWriter(os.Stdout))
+			chainID := viper.GetString("chain_id")
+
+			var seeds []string
+			for _, seed := range viper.GetStringSlice("seeds") {
+				if seed = strings.TrimSpace(seed); seed != "" {
+					seeds = append(seeds, seed)
+				}
+			}
+			if name := viper.GetString("network"); name != "" {
+				network, err := inventory.Load(name)
+				if err != nil {
+					return err
+				}
+				for _, node := range network.Nodes {
+					if node.NodeID != "" && node.PublicIP != "" {
+						seeds = append(seeds, fmt.Sprintf("%s@%s:%d", node.NodeID, node.PublicIP, inventory.DefP2PPort))
+					}
+				}
+			}
+			if len(seeds) == 0 {
+				return fmt.Errorf("no seeds, set --seeds or --network")
+			}
+			seedAddrs, errs := p2p.NewNetAddressStrings(seeds)
+			for _, err := range errs {
+				myLog.Error("invalid seed", "err", err)
+			}
+			if len(seedAddrs) == 0 {
+				return fmt.Errorf("no valid seeds")
+			}
+
+			cfg := config.DefaultP2PConfig()
+			cfg.DialTimeout = viper.GetDuration("dial_timeout")
+			// the crawler dials on its own, keep the pex reactor from dialing the book
+			cfg.MaxNumOutboundPeers = 0
+			// nodes of a local testnet share an ip
+			cfg.AllowDuplicateIP = true
+
+			// only crawl errors are interesting, dial failures end up in the report
+			filteredLogger := log.NewFilter(myLog, log.AllowError())
+			node, err := newSeedNode(filteredLogger, cfg, GetNodeKey(viper.GetString("secret")), chainID,
+				viper.GetString("laddr"), viper.GetString("addr_book_file"), false, false)
+			if err != nil {
+				return err
+			}
+			reactor := &crawlReactor{Reactor: node.pex, waiting: make(map[p2p.ID]chan []*p2p.NetAddress)}
+			node.sw.AddReactor("pex", reactor)
+			node.sw.SetNodeInfo(node.nodeInfo)
+			if err = node.sw.Start(); err != nil {
+				return err
+			}
+			defer func() { _ = node.sw.Stop() }()
+
+			report := crawl(node.sw, reactor, seedAddrs, viper.GetInt("parallel"), viper.GetInt("max_depth"),
+				viper.GetInt("max_addrs"), viper.GetDuration("addrs_timeout"))
+			report.ChainID = chainID
+
+			fmt.Printf("addresses: %d, reachable: %d, unreachable: %d\n", report.Addresses, report.Reachable, report.Unreachable)
+			fmt.Printf("nodes: %d, reachable: %d\n", report.Nodes, report.ReachableNodes)
+			for _, version := range sortedKeys(report.Versions) {
+				fmt.Printf("\tversion %s: %d\n", version, report.Versions[version])
+			}
+			for _, kind := range sortedKeys(report.Errors) {
+				fmt.Printf("\terror %s: %d\n", kind, report.Errors[kind])
+			}
+
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(viper.GetString("output"), data, 0644)
+		},
+	}
+	cmd.Flags().String("secret", "", "node key secret of the crawler, a random key by default")
+	cmd.Flags().String("chain_id", "hub", "network identifier")
+	cmd.Flags().String("laddr", "tcp://0.0.0.0:26666", "Address to listen for incoming connections")
+	cmd.Flags().StringSlice("seeds", []string{}, "id@host:port to start crawling from")
+	cmd.Flags().String("network", "", "also start from the nodes of this inventory network with a known node id")
+	cmd.Flags().String("addr_book_file", filepath.Join(os.TempDir(), "fx-crawl-addr-book.json"), "")
+	cmd.Flags().Uint("parallel", 16, "concurrent dials")
+	cmd.Flags().Uint("max_depth", 0, "stop following addresses this many hops from the seeds, 0 for no limit")
+	cmd.Flags().Uint("max_addrs", 1000, "stop after dialing this many addresses, 0 for no limit")
+	cmd.Flags().Duration("dial_timeout", 3*time.Second, "")
+	cmd.Flags().Duration("addrs_timeout", 10*time.Second, "wait this long for a peer to answer an address request")
+	cmd.Flags().String("output", "crawl.json", "crawl report file")
+	return cmd
+}
+
+// crawlReactor hands the addresses a peer answers with to the crawler waiting on it
+type crawlReactor struct {
+	*pex.Reactor
+	mu      sync.Mutex
+	waiting map[p2p.ID]chan []*p2p.NetAddress
+}
+
+func (r *crawlReactor) expect(id p2p.ID) <-chan []*p2p.NetAddress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan []*p2p.NetAddress, 1)
+	r.waiting[id] = ch
+	return ch
+}
+
+func (r *crawlReactor) forget(id p2p.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.waiting, id)
+}
+
+func (r *crawlReactor) Receive(chID byte, src p2p.Peer, msgBytes []byte) {
+	var msg pexMessage
+	if chID == pex.PexChannel && pexCdc.UnmarshalBinaryBare(msgBytes, &msg) == nil {
+		if addrs, ok := msg.(*pexAddrsMessage); ok {
+			r.mu.Lock()
+			if ch, ok := r.waiting[src.ID()]; ok {
+				select {
+				case ch <- addrs.Addrs:
+				default:
+				}
+			}
+			r.mu.Unlock()
+		}
+	}
+	r.Reactor.Receive(chID, src, msgBytes)
+}
+
+type crawler struct {
+	sw           *p2p.Switch
+	reactor      *crawlReactor
+	maxDepth     int
+	maxAddrs     int
+	addrsTimeout time.Duration
+
+	wg    sync.WaitGroup
+	sem   chan struct{}
+	mu    sync.Mutex
+	seen  map[string]bool
+	ids   map[p2p.ID]*sync.Mutex
+	peers []*CrawlPeer
+}
+
+// crawl dials the seeds, asks every reachable peer for addresses and dials those in turn
+func crawl(sw *p2p.Switch, reactor *crawlReactor, seeds []*p2p.NetAddress, parallel, maxDepth, maxAddrs int, addrsTimeout time.Duration) *CrawlReport {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	c := &crawler{
+		sw:           sw,
+		reactor:      reactor,
+		maxDepth:     maxDepth,
+		maxAddrs:     maxAddrs,
+		addrsTimeout: addrsTimeout,
+		sem:          make(chan struct{}, parallel),
+		seen:         make(map[string]bool),
+		ids:          make(map[p2p.ID]*sync.Mutex),
+	}
+	report := &CrawlReport{Start: time.Now()}
+	for _, seed := range seeds {
+		report.Seeds = append(report.Seeds, seed.String())
+		c.enqueue(seed, "", 0)
+	}
+	c.wg.Wait()
+	report.End = time.Now()
+
+	sort.Slice(c.peers, func(i, j int) bool {
+		if c.peers[i].Depth != c.peers[j].Depth {
+			return c.peers[i].Depth < c.peers[j].Depth
+		}
+		return c.peers[i].Addr < c.peers[j].Addr
+	})
+	report.Peers = c.peers
+	report.Versions = make(map[string]int)
+	report.Errors = make(map[string]int)
+	var nodes = make(map[string]bool)
+	for _, peer := range c.peers {
+		report.Addresses++
+		if peer.Reachable {
+			report.Reachable++
+		} else {
+			report.Unreachable++
+			report.Errors[peer.ErrorKind]++
+		}
+		// a node is reachable if any of its addresses is
+		if reachable, ok := nodes[peer.ID]; !ok || (!reachable && peer.Reachable) {
+			if peer.Reachable {
+				report.Versions[peer.Version]++
+			}
+			nodes[peer.ID] = peer.Reachable
+		}
+	}
+	report.Nodes = len(nodes)
+	for _, reachable := range nodes {
+		if reachable {
+			report.ReachableNodes++
+		}
+	}
+	return report
+}
+
+func (c *crawler) enqueue(addr *p2p.NetAddress, source string, depth int) {
+	if addr.ID == c.sw.NodeInfo().ID() {
+		return
+	}
+	if c.maxDepth > 0 && depth > c.maxDepth {
+		return
+	}
+	c.mu.Lock()
+	key := addr.String()
+	if c.seen[key] || (c.maxAddrs > 0 && len(c.seen) >= c.maxAddrs) {
+		c.mu.Unlock()
+		return
+	}
+	c.seen[key] = true
+	if _, ok := c.ids[addr.ID]; !ok {
+		c.ids[addr.ID] = &sync.Mutex{}
+	}
+	idLock := c.ids[addr.ID]
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.sem <- struct{}{}
+		// one connection per node id at a time, a node is often advertised under several addresses
+		idLock.Lock()
+		peer := c.visit(addr, source, depth)
+		idLock.Unlock()
+		<-c.sem
+
+		c.mu.Lock()
+		c.peers = append(c.peers, peer)
+		c.mu.Unlock()
+	}()
+}
+
+func (c *crawler) visit(addr *p2p.NetAddress, source string, depth int) *CrawlPeer {
+	res := &CrawlPeer{ID: string(addr.ID), Addr: addr.DialString(), Source: source, Depth: depth}
+	addrs := c.reactor.expect(addr.ID)
+	defer c.reactor.forget(addr.ID)
+
+	if err := c.sw.DialPeerWithAddress(addr); err != nil {
+		res.Error, res.ErrorKind = err.Error(), dialErrorKind(err)
+		return res
+	}
+	peer := c.sw.Peers().Get(addr.ID)
+	if peer == nil {
+		res.Error, res.ErrorKind = "disconnected after handshake", "disconnected"
+		return res
+	}
+	defer c.sw.StopPeerGracefully(peer)
+
+	res.Reachable = true
+	if info, ok := peer.NodeInfo().(p2p.DefaultNodeInfo); ok {
+		res.Moniker = info.Moniker
+		res.Version = info.Version
+		res.Network = info.Network
+		res.Channels = info.Channels.String()
+		res.ListenAddr = info.ListenAddr
+		res.RPCAddr = info.Other.RPCAddress
+	}
+
+	c.reactor.RequestAddrs(peer)
+	select {
+	case list := <-addrs:
+		res.Addrs = len(list)
+		for _, next := range list {
+			c.enqueue(next, res.ID, depth+1)
+		}
+	case <-time.After(c.addrsTimeout):
+		res.Error = fmt.Sprintf("no addresses within %s", c.addrsTimeout)
+	}
+	return res
+}
+
+func dialErrorKind(err error) string {
+	if rejected, ok := err.(p2p.ErrRejected); ok {
+		switch {
+		case rejected.IsIncompatible():
+			return "incompatible"
+		case rejected.IsAuthFailure():
+			return "auth failure"
+		case rejected.IsDuplicate():
+			return "duplicate"
+		default:
+			return "rejected"
+		}
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "connection refused"):
+		return "refused"
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(msg, "no route to host"), strings.Contains(msg, "network is unreachable"):
+		return "unreachable"
+	}
+	return "other"
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tendermint/go-amino"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/p2p/pex"
+)
+
+// the address book file format, the same json tags as pex knownAddress
+type knownAddress struct {
+	Addr        *p2p.NetAddress `json:"addr"`
+	Src         *p2p.NetAddress `json:"src"`
+	Buckets     []int           `json:"buckets"`
+	Attempts    int32           `json:"attempts"`
+	BucketType  byte            `json:"bucket_type"`
+	LastAttempt time.Time       `json:"last_attempt"`
+	LastSuccess time.Time       `json:"last_success"`
+	LastBanTime time.Time       `json:"last_ban_time"`
+}
+
+type addrBookJSON struct {
+	Key   string          `json:"key"`
+	Addrs []*knownAddress `json:"addrs"`
+}
+
+const (
+	bucketTypeNew = 0x01
+	bucketTypeOld = 0x02
+)
+
+type SeedPeer struct {
+	ID          string    `json:"id"`
+	Addr        string    `json:"addr"`
+	Src         string    `json:"src"`
+	Bucket      string    `json:"bucket"`
+	Attempts    int32     `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+type SeedAddrBook struct {
+	Size  int        `json:"size"`
+	New   int        `json:"new"`
+	Old   int        `json:"old"`
+	Peers []SeedPeer `json:"peers"`
+}
+
+// readAddrBook saves the address book and reads it back, the AddrBook interface does not expose its entries
+func readAddrBook(book pex.AddrBook, file string) (*SeedAddrBook, error) {
+	book.Save()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var bookJSON addrBookJSON
+	if err = json.Unmarshal(data, &bookJSON); err != nil {
+		return nil, err
+	}
+	res := &SeedAddrBook{Size: len(bookJSON.Addrs), Peers: make([]SeedPeer, 0, len(bookJSON.Addrs))}
+	for _, ka := range bookJSON.Addrs {
+		if ka.Addr == nil {
+			continue
+		}
+		peer := SeedPeer{
+			ID:          string(ka.Addr.ID),
+			Addr:        ka.Addr.DialString(),
+			Bucket:      "new",
+			Attempts:    ka.Attempts,
+			LastAttempt: ka.LastAttempt,
+			LastSeen:    ka.LastSuccess,
+		}
+		if ka.Src != nil {
+			peer.Src = ka.Src.String()
+		}
+		switch ka.BucketType {
+		case bucketTypeOld:
+			res.Old++
+			peer.Bucket = "old"
+		case bucketTypeNew:
+			res.New++
+		}
+		res.Peers = append(res.Peers, peer)
+	}
+	sort.Slice(res.Peers, func(i, j int) bool { return res.Peers[i].LastSeen.After(res.Peers[j].LastSeen) })
+	return res, nil
+}
+
+type seedMetrics struct {
+	registry           *prometheus.Registry
+	inboundConnections prometheus.Counter
+	pexRequests        prometheus.Counter
+	addrsServed        prometheus.Counter
+}
+
+func newSeedMetrics(sw *p2p.Switch, book pex.AddrBook) *seedMetrics {
+	m := &seedMetrics{
+		registry: prometheus.NewRegistry(),
+		inboundConnections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "fx",
+			Subsystem: "seed",
+			Name:      "inbound_connections_total",
+			Help:      "inbound peer connections accepted",
+		}),
+		pexRequests: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "fx",
+			Subsystem: "seed",
+			Name:      "pex_requests_total",
+			Help:      "address requests answered",
+		}),
+		addrsServed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "fx",
+			Subsystem: "seed",
+			Name:      "addrs_served_total",
+			Help:      "addresses sent to peers",
+		}),
+	}
+	m.registry.MustRegister(m.inboundConnections, m.pexRequests, m.addrsServed,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "fx",
+			Subsystem: "seed",
+			Name:      "peers",
+			Help:      "connected peers",
+		}, func() float64 { return float64(sw.Peers().Size()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "fx",
+			Subsystem: "seed",
+			Name:      "addr_book_size",
+			Help:      "known addresses",
+		}, func() float64 { return float64(book.Size()) }),
+	)
+	return m
+}
+
+// startSeedHTTPServer serves the address book on /peers and the seed metrics on /metrics
+func startSeedHTTPServer(laddr string, book pex.AddrBook, bookFile string, metrics *seedMetrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, _ *http.Request) {
+		res, err := readAddrBook(book, bookFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+	})
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{MaxRequestsInFlight: 3}))
+	return &http.Server{Addr: laddr, Handler: mux}
+}
+
+// local copies of the pex messages, registered under the same names so the encoding matches
+type pexMessage interface{}
+type pexRequestMessage struct{}
+type pexAddrsMessage struct {
+	Addrs []*p2p.NetAddress
+}
+
+var pexCdc = amino.NewCodec()
+
+func init() {
+	pexCdc.RegisterInterface((*pexMessage)(nil), nil)
+	pexCdc.RegisterConcrete(&pexRequestMessage{}, "tendermint/p2p/PexRequestMessage", nil)
+	pexCdc.RegisterConcrete(&pexAddrsMessage{}, "tendermint/p2p/PexAddrsMessage", nil)
+}
+
+// seedReactor counts what the pex reactor does for the metrics
+type seedReactor struct {
+	*pex.Reactor
+	metrics *seedMetrics
+}
+
+func (r *seedReactor) AddPeer(peer p2p.Peer) {
+	if !peer.IsOutbound() {
+		r.metrics.inboundConnections.Inc()
+	}
+	r.Reactor.AddPeer(peer)
+}
+
+func (r *seedReactor) Receive(chID byte, src p2p.Peer, msgBytes []byte) {
+	r.Reactor.Receive(chID, &servedPeer{Peer: src, metrics: r.metrics}, msgBytes)
+}
+
+type servedPeer struct {
+	p2p.Peer
+	metrics *seedMetrics
+}
+
+func (p *servedPeer) count(chID byte, msgBytes []byte) {
+	if chID != pex.PexChannel {
+		return
+	}
+	var msg pexMessage
+	if err := pexCdc.UnmarshalBinaryBare(msgBytes, &msg); err != nil {
+		return
+	}
+	if addrs, ok := msg.(*pexAddrsMessage); ok {
+		p.metrics.pexRequests.Inc()
+		p.metrics.addrsServed.Add(float64(len(addrs.Addrs)))
+	}
+}
+
+func (p *servedPeer) Send(chID byte, msgBytes []byte) bool {
+	ok := p.Peer.Send(chID, msgBytes)
+	if ok {
+		p.count(chID, msgBytes)
+	}
+	return ok
+}
+
+func (p *servedPeer) TrySend(chID byte, msgBytes []byte) bool {
+	ok := p.Peer.TrySend(chID, msgBytes)
+	if ok {
+		p.count(chID, msgBytes)
+	}
+	return ok
+}
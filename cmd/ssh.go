@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"fx-tools/aws"
+	"fx-tools/inventory"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func NewSSHCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "ssh <node> [command...]",
+		Short:   "open a shell on a node with its key from the inventory, or run command",
+		Example: "fx ssh --network test validator-0\nfx ssh --network test 10.0.0.1 -- docker ps",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			network, err := inventory.Load(viper.GetString("network"))
+			if err != nil {
+				return err
+			}
+			node, ok := network.Node(args[0])
+			if !ok {
+				return fmt.Errorf("node %s not found in network %s", args[0], network.Name)
+			}
+			key, err := node.Key()
+			if err != nil {
+				return err
+			}
+			client, err := aws.DialSSH(node.PublicIP, key)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			session, err := client.NewSession()
+			if err != nil {
+				return err
+			}
+			defer session.Close()
+			session.Stdin, session.Stdout, session.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if len(args) > 1 {
+				return session.Run(strings.Join(args[1:], " "))
+			}
+			return interactiveShell(session)
+		},
+	}
+	cmd.Flags().String("network", "", "inventory network")
+	_ = cmd.MarkFlagRequired("network")
+	return cmd
+}
+
+// interactiveShell runs a login shell, with a pty of the size of the local terminal if there is one
+func interactiveShell(session *ssh.Session) error {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = terminal.Restore(fd, state) }()
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err = session.RequestPty(term, height, width, modes); err != nil {
+			return err
+		}
+	}
+	if err := session.Shell(); err != nil {
+		return err
+	}
+	return session.Wait()
+}
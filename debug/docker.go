@@ -7,7 +7,6 @@ import (
 
 	"fx-tools/aws"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/spf13/cobra"
 )
 
@@ -16,13 +15,7 @@ func NewRestoreAuthorizedKeys() *cobra.Command {
 		Use:     "restore",
 		Example: "fx chain status",
 		RunE: func(*cobra.Command, []string) (err error) {
-			stackTemplateRUL := ""
-			client, err := aws.NewAWSClient("us-east-1", stackTemplateRUL, credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     "",
-					SecretAccessKey: "",
-				},
-			})
+			client, err := aws.NewDefAWSClient()
 			if err != nil {
 				return err
 			}
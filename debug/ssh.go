@@ -1,190 +1,51 @@
 package debug
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"path/filepath"
 	"strings"
-	"time"
+
+	"fx-tools/fleet"
 
 	"github.com/spf13/cobra"
-	"golang.org/x/crypto/ssh"
+	"github.com/spf13/viper"
 )
 
 func NewClearLog() *cobra.Command {
-	xcmd := &cobra.Command{
-		Use: "clear-log",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			dir, err := ioutil.ReadDir("./keys")
-			if err != nil {
-				return err
-			}
-			for _, file := range dir {
-				fileData, err := ioutil.ReadFile(filepath.Join("./keys", file.Name()))
-				if err != nil {
-					return err
-				}
-				ip := file.Name()
-				if strings.HasSuffix(ip, ".pem") {
-					ip = ip[:len(ip)-4]
-				}
-				_, session, err := NewSSHClient(ip, fileData)
-				if err != nil {
-					return err
-				}
-
-				cmd := `echo "clear log success" | sudo tee $(docker inspect --format='{{.LogPath}}' fx-chain)`
-				//if err = session.Run(cmd); err != nil {
-				//	return err
-				//}
-				output, err := session.Output(cmd)
-				if err != nil {
-					return err
-				}
-
-				session.Close()
-			}
-			return nil
-		}}
-	return xcmd
+	return fleet.NewCommand("clear-log", "truncate the docker log of fx-chain on every node",
+		`echo "clear log success" | sudo tee $(docker inspect --format='{{.LogPath}}' fx-chain)`)
 }
 
 func NewDFH() *cobra.Command {
-	xcmd := &cobra.Command{
-		Use: "df-all",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			dir, err := ioutil.ReadDir("./keys")
-			if err != nil {
-				return err
-			}
-			for _, file := range dir {
-				fileData, err := ioutil.ReadFile(filepath.Join("./keys", file.Name()))
-				if err != nil {
-					return err
-				}
-				ip := file.Name()
-				if strings.HasSuffix(ip, ".pem") {
-					ip = ip[:len(ip)-4]
-				}
-				_, session, err := NewSSHClient(ip, fileData)
-				if err != nil {
-					return err
-				}
-
-				output, err := session.Output("df -h | grep /dev/nvme")
-				if err != nil {
-					return err
-				}
-
-				session.Close()
-			}
-			return nil
-		}}
-	return xcmd
+	return fleet.NewCommand("df-all", "disk usage of every node", "df -h | grep /dev/nvme")
 }
 
 func NewDockerLog() *cobra.Command {
-	xcmd := &cobra.Command{
-		Use:   "docker-level",
-		Short: "",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			dir, err := ioutil.ReadDir("./keys")
-			if err != nil {
-				return err
-			}
-			for i, file := range dir {
-				fileData, err := ioutil.ReadFile(filepath.Join("./keys", file.Name()))
-				if err != nil {
-					return err
-				}
-				ip := file.Name()
-				if strings.HasSuffix(ip, ".pem") {
-					ip = ip[:len(ip)-4]
-				}
-				_, session, err := NewSSHClient(ip, fileData)
-				if err != nil {
-					return err
-				}
-
-				output, err := session.Output("docker cp fx-chain:/root/.fx/config/config.toml . && cat config.toml | grep log_level")
-				if err != nil {
-					return err
-				}
-
-				session.Close()
-			}
-			return nil
-		}}
-	return xcmd
+	return fleet.NewCommand("docker-level", "log level of fx-chain on every node",
+		"docker cp fx-chain:/root/.fx/config/config.toml /tmp/config.toml && grep log_level /tmp/config.toml")
 }
 
 func NewAddPublicKey() *cobra.Command {
-	xcmd := &cobra.Command{
-		Use: "add-pub-key",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			dir, err := ioutil.ReadDir("./keys")
+	cmd := &cobra.Command{
+		Use:     "add-pub-key",
+		Short:   "authorize a public key on every node, once",
+		Example: "fx add-pub-key --network test --key ~/.ssh/id_rsa.pub",
+		Args:    cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			data, err := ioutil.ReadFile(viper.GetString("key"))
 			if err != nil {
 				return err
 			}
-			for i, file := range dir {
-				fileData, err := ioutil.ReadFile(filepath.Join("./keys", file.Name()))
-				if err != nil {
-					return err
-				}
-				ip := file.Name()
-				if strings.HasSuffix(ip, ".pem") {
-					ip = ip[:len(ip)-4]
-				}
-				_, session, err := NewSSHClient(ip, fileData)
-				if err != nil {
-					return err
-				}
-
-				cmd := `echo -e "`
-				output, err := session.Output(cmd)
-				if err != nil {
-					return err
-				}
-
-				session.Close()
+			key := strings.TrimSpace(string(data))
+			if key == "" || strings.ContainsAny(key, "'\n") {
+				return errors.New("the key file must hold a single public key line")
 			}
-			return nil
-		}}
-	return xcmd
-}
-
-func NewSSHClient(IP string, privKey []byte) (*ssh.Client, *ssh.Session, error) {
-	auth, err := GetSSHAuth(privKey)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	cfg := &ssh.ClientConfig{
-		Config:          ssh.Config{},
-		User:            "ubuntu",
-		Auth:            []ssh.AuthMethod{auth},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		BannerCallback:  ssh.BannerDisplayStderr(),
-		Timeout:         5 * time.Second,
-	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", IP, 22), cfg)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	session, err := client.NewSession()
-	if err != nil {
-		return nil, nil, err
-	}
-	return client, session, nil
-}
-
-func GetSSHAuth(pemKey []byte) (ssh.AuthMethod, error) {
-	// Create the Signer for this private key.
-	signer, err := ssh.ParsePrivateKey(pemKey)
-	if err != nil {
-		return nil, err
+			return fleet.RunFromFlags(fmt.Sprintf(`grep -qxF '%s' ~/.ssh/authorized_keys || echo '%s' >> ~/.ssh/authorized_keys`, key, key))
+		},
 	}
-	return ssh.PublicKeys(signer), nil
+	fleet.AddFlags(cmd)
+	cmd.Flags().String("key", "", "public key file")
+	_ = cmd.MarkFlagRequired("key")
+	return cmd
 }
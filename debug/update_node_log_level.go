@@ -7,7 +7,6 @@ import (
 	"fx-tools/aws"
 	"fx-tools/docker"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/docker/docker/api/types"
 	"github.com/spf13/cobra"
 )
@@ -17,13 +16,7 @@ func NewUpdateNodeLogLevel() *cobra.Command {
 		Use: "up-log-level",
 		RunE: func(_ *cobra.Command, _ []string) (err error) {
 
-			stackTemplateRUL := ""
-			client, err := aws.NewAWSClient("us-east-1", stackTemplateRUL, credentials.StaticProvider{
-				Value: credentials.Value{
-					AccessKeyID:     "",
-					SecretAccessKey: "",
-				},
-			})
+			client, err := aws.NewDefAWSClient()
 			if err != nil {
 				return err
 			}
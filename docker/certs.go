@@ -0,0 +1,188 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CertOptions of GenerateCerts
+type CertOptions struct {
+	// Hosts IPs and names added to the server certificate, localhost and 127.0.0.1 always are
+	Hosts []string
+	Days  int
+	// Force replaces the server and client certificates, the CA is always kept
+	Force bool
+}
+
+// GenerateCerts writes a CA to dir unless it has one, and the server and client certificates it signs,
+// it returns the files written
+func GenerateCerts(dir string, opts CertOptions) ([]string, error) {
+	if opts.Days <= 0 {
+		return nil, errors.New("days must be positive")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	var written []string
+	notAfter := time.Now().Add(time.Duration(opts.Days) * 24 * time.Hour)
+
+	ca, caKey, err := loadCA(dir)
+	if _, statErr := os.Stat(filepath.Join(dir, CAFile)); os.IsNotExist(statErr) {
+		ca, caKey, err = newCert(&x509.Certificate{
+			Subject:               pkix.Name{CommonName: "fx docker CA"},
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			NotAfter:              notAfter,
+		}, nil, nil)
+		if err == nil {
+			err = writeCert(dir, CAFile, CAKeyFile, ca, caKey)
+			written = append(written, CAFile, CAKeyFile)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	server := serverTemplate(opts.Hosts, notAfter)
+	client := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "fx client"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		NotAfter:    notAfter,
+	}
+	for _, c := range []struct {
+		template        *x509.Certificate
+		certFile, kFile string
+	}{{server, ServerCertFile, ServerKeyFile}, {client, CertFile, KeyFile}} {
+		if _, err := os.Stat(filepath.Join(dir, c.certFile)); err == nil && !opts.Force {
+			continue
+		}
+		cert, key, err := newCert(c.template, ca, caKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeCert(dir, c.certFile, c.kFile, cert, key); err != nil {
+			return nil, err
+		}
+		written = append(written, c.certFile, c.kFile)
+	}
+	return written, nil
+}
+
+// SignServerCert signs the PEM certificate request of a daemon with the CA of dir, so its key never
+// leaves its host. The certificate names hosts and expires with the CA
+func SignServerCert(dir string, csrPEM []byte, hosts []string) ([]byte, error) {
+	ca, caKey, err := loadCA(dir)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("not a PEM certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	cert, err := signCert(serverTemplate(hosts, ca.NotAfter), ca, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), nil
+}
+
+func serverTemplate(hosts []string, notAfter time.Time) *x509.Certificate {
+	server := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "fx docker"},
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotAfter:    notAfter,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			server.IPAddresses = append(server.IPAddresses, ip)
+		} else {
+			server.DNSNames = append(server.DNSNames, host)
+		}
+	}
+	return server
+}
+
+// newCert signs template and a new key with parent, self-signed when parent is nil
+func newCert(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	cert, err := signCert(template, parent, &key.PublicKey, parentKey)
+	return cert, key, err
+}
+
+func signCert(template, parent *x509.Certificate, pub interface{}, parentKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := ioutil.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("the CA files of " + dir + " are not PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	return cert, key, err
+}
+
+func writeCert(dir, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err = ioutil.WriteFile(filepath.Join(dir, certFile), certPEM, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return ioutil.WriteFile(filepath.Join(dir, keyFile), keyPEM, 0600)
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewDockerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docker",
+		Short: "the TLS material of the docker daemons",
+	}
+	certs := &cobra.Command{
+		Use:   "certs",
+		Short: "the CA and certificates of the docker daemons and of this client",
+	}
+	gen := &cobra.Command{
+		Use:   "gen",
+		Short: "create a CA unless the dir has one, and the server and client certificates it signs",
+		Long: `The dir gets ca.pem and ca-key.pem, which sign the daemon of every new stack, server-cert.pem and
+server-key.pem for a daemon started by hand, and cert.pem and key.pem for this client.
+Existing certificates are kept without --force, the CA always is.`,
+		Example: "fx docker certs gen --dir ./certs",
+		Args:    cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			dir := CertDir(viper.GetString("dir"))
+			written, err := GenerateCerts(dir, CertOptions{
+				Hosts: viper.GetStringSlice("hosts"),
+				Days:  viper.GetInt("days"),
+				Force: viper.GetBool("force"),
+			})
+			if err != nil {
+				return err
+			}
+			if len(written) == 0 {
+				fmt.Printf("%s already has every certificate, --force to replace them\n", dir)
+			}
+			for _, file := range written {
+				fmt.Println(filepath.Join(dir, file))
+			}
+			return nil
+		},
+	}
+	gen.Flags().String("dir", "", "cert dir, [docker] cert_path, then DOCKER_CERT_PATH, then ~/.docker by default")
+	gen.Flags().StringSlice("hosts", nil, "extra IPs and names of the server certificate")
+	gen.Flags().Int("days", 3650, "validity of the certificates")
+	gen.Flags().Bool("force", false, "replace the server and client certificates")
+	certs.AddCommand(gen)
+	cmd.AddCommand(certs)
+	return cmd
+}
@@ -1,17 +1,20 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
-	"runtime"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"hub/logger"
@@ -24,30 +27,44 @@ import (
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/docker/pkg/term"
 	"github.com/docker/go-connections/nat"
-	"github.com/docker/go-connections/tlsconfig"
 )
 
+// NewCli a client of the daemon on host: the environment (DOCKER_HOST and the like) when empty,
+// unix:// and npipe:// as is, tcp:// over TLS with GetTLSConfig. The API version is negotiated
+// with the daemon, the client default is kept when it does not answer.
 func NewCli(host string) (*client.Client, error) {
-	if host == "tcp://127.0.0.1:2376" && runtime.GOOS == "darwin" {
-		return client.NewClientWithOpts(client.FromEnv)
+	var cli *client.Client
+	var err error
+	switch {
+	case host == "":
+		cli, err = client.NewClientWithOpts(client.FromEnv)
+	case strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://"):
+		cli, err = client.NewClientWithOpts(client.WithHost(host))
+	default:
+		tlsConfig, tlsErr := GetTLSConfig().ClientTLS()
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		}
+		cli, err = client.NewClientWithOpts(client.WithHost(host), client.WithHTTPClient(httpClient))
 	}
-
-	tlsCert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
 	if err != nil {
 		return nil, err
 	}
 
-	tlsConfig := tlsconfig.ClientDefault()
-	tlsConfig.InsecureSkipVerify = true
-	tlsConfig.Certificates = []tls.Certificate{tlsCert}
-
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ping, err := cli.Ping(ctx)
+	if err != nil {
+		logger.L.Debugf("docker %s version not negotiated: %s", host, err.Error())
+		return cli, nil
 	}
-
-	return client.NewClientWithOpts(client.WithHost(host), client.WithVersion("1.40"), client.WithHTTPClient(httpClient))
+	cli.NegotiateAPIVersionPing(ping)
+	return cli, nil
 }
 
 func Pull(cli *client.Client, image string) error {
@@ -124,6 +141,183 @@ func Run(cli *client.Client, image, name string, cmd, env, ports []string) (id s
 	return containerCreateBody.ID, err
 }
 
+// RunOnce runs a short-lived container to completion and removes it, returning its output
+func RunOnce(cli *client.Client, image, name string, cmd []string, hostConfig *container.HostConfig) (output string, err error) {
+	logger.L.Debugf("docker run once image: %s, cmd: %v", image, cmd)
+
+	if err = Pull(cli, image); err != nil {
+		logger.L.Errorf("docker pull image %s error: %s", image, err.Error())
+	}
+
+	ctx := context.Background()
+	if name != "" {
+		// left by an interrupted run, the create would fail on the name
+		if err = cli.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+			return
+		}
+	}
+	containerCreateBody, err := cli.ContainerCreate(ctx, &container.Config{Image: image, Cmd: cmd}, hostConfig, &network.NetworkingConfig{}, name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err := cli.ContainerRemove(ctx, containerCreateBody.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			logger.L.Warnf("docker remove container %s: %s", name, err.Error())
+		}
+	}()
+
+	if err = cli.ContainerStart(ctx, containerCreateBody.ID, types.ContainerStartOptions{}); err != nil {
+		return
+	}
+
+	var exitCode int64
+	statusCh, errCh := cli.ContainerWait(ctx, containerCreateBody.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		return
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	responseBody, err := cli.ContainerLogs(ctx, containerCreateBody.ID, types.ContainerLogsOptions{ShowStderr: true, ShowStdout: true})
+	if err != nil {
+		return
+	}
+	defer responseBody.Close()
+
+	var writerBuf = new(bytes.Buffer)
+	_, _ = stdcopy.StdCopy(writerBuf, writerBuf, responseBody)
+	output = writerBuf.String()
+	if exitCode != 0 {
+		err = fmt.Errorf("%s exit code %d: %s", name, exitCode, output)
+	}
+	return
+}
+
+// WaitReady pings the daemon on host until it accepts a TLS connection, the user data of a new
+// instance installs docker after the stack is already complete
+func WaitReady(host string, timeout time.Duration) error {
+	cli, err := NewCli(host)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = cli.Ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("docker %s not ready after %s: %s", host, timeout, err.Error())
+		}
+		logger.L.Debugf("wait docker %s: %s", host, err.Error())
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// CopyFiles writes files, name -> content, into dir of the container
+func CopyFiles(cli *client.Client, container, dir string, files map[string][]byte) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cli.CopyToContainer(context.Background(), container, dir, &buf, types.CopyToContainerOptions{})
+}
+
+// ReadFile the content of the file path of the container, running or not
+func ReadFile(cli *client.Client, container, path string) ([]byte, error) {
+	reader, _, err := cli.CopyFromContainer(context.Background(), container, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// ClearDir empties dir of the container, which may be stopped: a file replaces dir, then an empty dir the file
+func ClearDir(cli *client.Client, container, dir string) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	name := path.Base(dir)
+	for _, hdr := range []*tar.Header{
+		{Name: name, Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()},
+		{Name: name + "/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cli.CopyToContainer(context.Background(), container, path.Dir(dir), &buf, types.CopyToContainerOptions{AllowOverwriteDirWithFile: true})
+}
+
+// ExtractTar writes the regular files and directories of the tar under dir
+func ExtractTar(r io.Reader, dir string) (files int, size int64, err error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, size, nil
+		}
+		if err != nil {
+			return files, size, err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return files, size, fmt.Errorf("tar entry %s is outside of %s", hdr.Name, dir)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return files, size, err
+			}
+		case tar.TypeReg:
+			n, err := WriteFile(target, os.FileMode(hdr.Mode).Perm(), tr)
+			if err != nil {
+				return files, size, err
+			}
+			files++
+			size += n
+		}
+	}
+}
+
+// WriteFile writes r to target, creating its directory
+func WriteFile(target string, mode os.FileMode, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(f, r)
+}
+
 func ExecAndRestart(cli *client.Client, container string, cmd, env []string) error {
 	logger.L.Infof("docker exec %s %v, %v", container, cmd, env)
 
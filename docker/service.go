@@ -1,9 +1,12 @@
 package docker
 
 import (
+	"errors"
 	"fmt"
 
 	"hub/logger"
+
+	"github.com/spf13/viper"
 )
 
 func StartChain(ip string, cmd []string) (err error) {
@@ -30,3 +33,52 @@ func StartPrometheus(ip string, cmd []string) (err error) {
 	_, err = Run(cli, , "fx-prometheus", cmd, nil, nil)
 	return
 }
+
+const GrafanaImage = "functionx/fx-grafana:latest"
+
+// GrafanaConfig the [grafana] section of config.toml
+type GrafanaConfig struct {
+	AdminPassword string `mapstructure:"admin_password"`
+	// Anonymous lets anyone reaching the port view the dashboards without a login
+	Anonymous bool `mapstructure:"anonymous"`
+}
+
+func GetGrafanaConfig() GrafanaConfig {
+	var cfg GrafanaConfig
+	if err := viper.UnmarshalKey("grafana", &cfg); err != nil {
+		panic(err.Error())
+	}
+	return cfg
+}
+
+// StartGrafana runs grafana with the fx dashboards, provisioned with the prometheus on prometheusURL
+func StartGrafana(ip, prometheusURL string) (err error) {
+	cfg := GetGrafanaConfig()
+	if cfg.AdminPassword == "" {
+		return errors.New("no grafana admin password, set admin_password in the [grafana] config")
+	}
+	cli, err := NewCli(fmt.Sprintf("tcp://%s:2376", ip))
+	if err != nil {
+		return
+	}
+
+	env := []string{
+		fmt.Sprintf("PROMETHEUS_URL=%s", prometheusURL),
+		fmt.Sprintf("GF_SECURITY_ADMIN_PASSWORD=%s", cfg.AdminPassword),
+		fmt.Sprintf("GF_AUTH_ANONYMOUS_ENABLED=%t", cfg.Anonymous),
+	}
+	_, err = Run(cli, GrafanaImage, "fx-grafana", nil, env, nil)
+	return
+}
+
+const SeedImage = "functionx/fx-tools:latest"
+
+func StartSeed(ip string, cmd []string) (err error) {
+	cli, err := NewCli(fmt.Sprintf("tcp://%s:2376", ip))
+	if err != nil {
+		return
+	}
+
+	_, err = Run(cli, SeedImage, "fx-seed", append([]string{"seed"}, cmd...), nil, nil)
+	return
+}
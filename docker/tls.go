@@ -0,0 +1,135 @@
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/spf13/viper"
+)
+
+// the files of a cert dir, named as the docker cli expects them
+const (
+	CAFile         = "ca.pem"
+	CAKeyFile      = "ca-key.pem"
+	CertFile       = "cert.pem"
+	KeyFile        = "key.pem"
+	ServerCertFile = "server-cert.pem"
+	ServerKeyFile  = "server-key.pem"
+)
+
+// TLSConfig the [docker] section of config.toml
+type TLSConfig struct {
+	// CertPath holds ca.pem, cert.pem and key.pem, see CertDir when empty
+	CertPath string `mapstructure:"cert_path"`
+	// CA, Cert and Key override the files of CertPath
+	CA   string `mapstructure:"ca"`
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+	// Insecure accepts any daemon certificate, only for hosts set up before the CA
+	Insecure bool `mapstructure:"insecure"`
+}
+
+func GetTLSConfig() TLSConfig {
+	var cfg TLSConfig
+	if err := viper.UnmarshalKey("docker", &cfg); err != nil {
+		panic(err.Error())
+	}
+	return cfg
+}
+
+// CertDir dir when set, then [docker] cert_path, then DOCKER_CERT_PATH, then ~/.docker
+func CertDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if dir = viper.GetString("docker.cert_path"); dir != "" {
+		return dir
+	}
+	if dir = os.Getenv("DOCKER_CERT_PATH"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// Files the paths of the CA, the client certificate and its key
+func (c TLSConfig) Files() (ca, cert, key string) {
+	dir := CertDir(c.CertPath)
+	ca, cert, key = filepath.Join(dir, CAFile), filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile)
+	if c.CA != "" {
+		ca = c.CA
+	}
+	if c.Cert != "" {
+		cert = c.Cert
+	}
+	if c.Key != "" {
+		key = c.Key
+	}
+	return
+}
+
+// ClientTLS presents the client certificate when there is one and verifies the daemon certificate
+// against the CA. The host name is not checked, one server certificate serves every host.
+func (c TLSConfig) ClientTLS() (*tls.Config, error) {
+	caFile, certFile, keyFile := c.Files()
+	config := tlsconfig.ClientDefault()
+	if _, err := os.Stat(certFile); err == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	// verified by VerifyPeerCertificate instead
+	config.InsecureSkipVerify = true
+	if c.Insecure {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("docker CA: %s, see fx docker certs gen", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate in %s", caFile)
+	}
+	config.VerifyPeerCertificate = verifyChain(pool)
+	return config, nil
+}
+
+// verifyChain checks the peer certificate is a server certificate signed by the CA of roots
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no daemon certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+}
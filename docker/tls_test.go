@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCertsClientTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fx-certs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	written, err := GenerateCerts(dir, CertOptions{Days: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{CAFile, CAKeyFile, ServerCertFile, ServerKeyFile, CertFile, KeyFile}, written)
+	written, err = GenerateCerts(dir, CertOptions{Days: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, written)
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile))
+	assert.NoError(t, err)
+	caPEM, err := ioutil.ReadFile(filepath.Join(dir, CAFile))
+	assert.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(caPEM)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	config, err := TLSConfig{CertPath: dir}.ClientTLS()
+	assert.NoError(t, err)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	assert.NoError(t, err)
+	_ = conn.Close()
+
+	// a daemon certificate of another CA is rejected
+	other, err := ioutil.TempDir("", "fx-certs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(other)
+	_, err = GenerateCerts(other, CertOptions{Days: 1})
+	assert.NoError(t, err)
+	config, err = TLSConfig{CertPath: dir, CA: filepath.Join(other, CAFile)}.ClientTLS()
+	assert.NoError(t, err)
+	_, err = tls.Dial("tcp", listener.Addr().String(), config)
+	assert.Error(t, err)
+}
+
+func TestSignServerCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fx-certs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	_, err = GenerateCerts(dir, CertOptions{Days: 1})
+	assert.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "node"}}, key)
+	assert.NoError(t, err)
+	certPEM, err := SignServerCert(dir, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), []string{"203.0.113.7"})
+	assert.NoError(t, err)
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	caPEM, err := ioutil.ReadFile(filepath.Join(dir, CAFile))
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "203.0.113.7"})
+	assert.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, cert.PublicKey)
+
+	_, err = SignServerCert(dir, certPEM, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"fx-tools/inventory"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	OutputPrefix = "prefix"
+	OutputGroup  = "group"
+	OutputJSON   = "json"
+)
+
+func NewExecCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "exec -- <command>",
+		Short:   "run a shell command on the nodes of a network over ssh",
+		Example: "fx exec --network test --role validator -- docker ps\nfx exec --network test --output json -- df -h /",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return RunFromFlags(strings.Join(args, " "))
+		},
+	}
+	AddFlags(cmd)
+	return cmd
+}
+
+// NewCommand a command running script on the nodes of a network, with the flags of exec
+func NewCommand(use, short, script string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return RunFromFlags(script)
+		},
+	}
+	AddFlags(cmd)
+	return cmd
+}
+
+func AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("network", "", "inventory network")
+	cmd.Flags().StringSlice("node", nil, "node names or IPs, every node by default")
+	cmd.Flags().String("role", "", "only the nodes of this role")
+	cmd.Flags().Int("parallel", 10, "hosts at once")
+	cmd.Flags().Duration("timeout", time.Minute, "per host, 0 for none")
+	cmd.Flags().String("output", OutputPrefix, "prefix streams the lines of every host, group prints them per host, json")
+	_ = cmd.MarkFlagRequired("network")
+}
+
+// RunFromFlags runs script on the nodes selected by the flags of AddFlags, and fails unless it succeeds everywhere
+func RunFromFlags(script string) error {
+	nodes, err := SelectNodes(viper.GetString("network"), viper.GetStringSlice("node"), viper.GetString("role"))
+	if err != nil {
+		return err
+	}
+
+	opts := Options{Parallel: viper.GetInt("parallel"), Timeout: viper.GetDuration("timeout")}
+	output := viper.GetString("output")
+	var mu sync.Mutex
+	switch output {
+	case OutputPrefix:
+		width := nameWidth(nodes)
+		opts.OnLine = func(node string, stderr bool, line string) {
+			w := os.Stdout
+			if stderr {
+				w = os.Stderr
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "%-*s | %s\n", width, node, line)
+		}
+	case OutputGroup:
+		opts.OnDone = func(result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			writeGroup(os.Stdout, result)
+		}
+	case OutputJSON:
+	default:
+		return errors.New("unknown output: " + output)
+	}
+
+	results := Run(nodes, script, opts)
+	if output == OutputJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		WriteSummary(os.Stdout, results)
+	}
+
+	var failed int
+	for _, result := range results {
+		if !result.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed on %d of %d nodes", failed, len(results))
+	}
+	return nil
+}
+
+// SelectNodes the nodes of network matching keys, every node when empty, and role when set
+func SelectNodes(network string, keys []string, role string) ([]inventory.Node, error) {
+	inv, err := inventory.Load(network)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := inv.Select(keys)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		var selected []inventory.Node
+		for _, node := range nodes {
+			if node.Role == role {
+				selected = append(selected, node)
+			}
+		}
+		nodes = selected
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no node selected")
+	}
+	return nodes, nil
+}
+
+func nameWidth(nodes []inventory.Node) int {
+	var width int
+	for _, node := range nodes {
+		if len(node.Name) > width {
+			width = len(node.Name)
+		}
+	}
+	return width
+}
+
+func writeGroup(w io.Writer, result Result) {
+	fmt.Fprintf(w, "==> %s (%s) exit %d <==\n", result.Node, result.Host, result.ExitCode)
+	for _, out := range []string{result.Stdout, result.Stderr, result.Error} {
+		if out == "" {
+			continue
+		}
+		fmt.Fprint(w, out)
+		if !strings.HasSuffix(out, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// WriteSummary one line per host with its exit code, duration and error
+func WriteSummary(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nNODE\tHOST\tEXIT\tSECONDS\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\t%s\n", result.Node, result.Host, result.ExitCode, result.Seconds, result.Error)
+	}
+	_ = tw.Flush()
+}
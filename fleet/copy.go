@@ -0,0 +1,378 @@
+package fleet
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"hub/logger"
+
+	"fx-tools/aws"
+	"fx-tools/docker"
+	"fx-tools/inventory"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	MethodDocker = "docker"
+	MethodSFTP   = "sftp"
+)
+
+// Location a path on the nodes of a network, or a local path
+type Location struct {
+	Remote bool
+	// Nodes names or IPs, every node when empty
+	Nodes []string
+	Path  string
+}
+
+// ParseLocation parses <nodes>:<path>, nodes being a comma list of names or IPs or * for every node,
+// anything else is local, as are windows paths like C:\x
+func ParseLocation(s string) Location {
+	i := strings.Index(s, ":")
+	if i <= 0 || strings.ContainsAny(s[:i], `/\.`) && !isIP(s[:i]) || isDrive(s, i) {
+		return Location{Path: s}
+	}
+	loc := Location{Remote: true, Path: s[i+1:]}
+	if s[:i] != "*" {
+		loc.Nodes = strings.Split(s[:i], ",")
+	}
+	return loc
+}
+
+func isIP(s string) bool {
+	return strings.Trim(s, "0123456789.") == "" && strings.Count(s, ".") == 3
+}
+
+// isDrive tells whether the colon at i follows the drive letter of a windows path
+func isDrive(s string, i int) bool {
+	if i != 1 || len(s) < 3 || s[2] != '\\' && s[2] != '/' {
+		return false
+	}
+	c := s[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+type CopyOptions struct {
+	Parallel int
+	// Container the container of the remote paths, the node container when empty
+	Container string
+	// Host copies from and to the host filesystem of the nodes over sftp instead of their container
+	Host bool
+}
+
+// CopyResult of a copy with one node, Method tells whether the docker API or sftp was used
+type CopyResult struct {
+	Node   string `json:"node"`
+	Host   string `json:"host"`
+	Method string `json:"method"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+	Dir    string `json:"dir,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Pull copies remotePath of every node into localDir, into localDir/<node> when there are several nodes
+func Pull(nodes []inventory.Node, remotePath, localDir string, opts CopyOptions) []CopyResult {
+	return fanOut(nodes, opts.Parallel, func(node inventory.Node) CopyResult {
+		dir := localDir
+		if len(nodes) > 1 {
+			dir = filepath.Join(localDir, node.Name)
+		}
+		result := CopyResult{Node: node.Name, Host: node.PublicIP, Dir: dir}
+		var err error
+		if err = os.MkdirAll(dir, 0755); err == nil {
+			result.Method, result.Files, result.Bytes, err = pullNode(node, remotePath, dir, opts)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	})
+}
+
+// Push copies localPath into remoteDir of every node, remoteDir must exist
+func Push(nodes []inventory.Node, localPath, remoteDir string, opts CopyOptions) []CopyResult {
+	return fanOut(nodes, opts.Parallel, func(node inventory.Node) CopyResult {
+		result := CopyResult{Node: node.Name, Host: node.PublicIP}
+		var err error
+		result.Method, result.Files, result.Bytes, err = pushNode(node, localPath, remoteDir, opts)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	})
+}
+
+func fanOut(nodes []inventory.Node, parallel int, copy func(node inventory.Node) CopyResult) []CopyResult {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	results := make([]CopyResult, len(nodes))
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, node inventory.Node) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = copy(node)
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+func containerOf(node inventory.Node, opts CopyOptions) string {
+	if opts.Container != "" {
+		return opts.Container
+	}
+	return node.ContainerName()
+}
+
+func pullNode(node inventory.Node, remotePath, dir string, opts CopyOptions) (method string, files int, size int64, err error) {
+	if opts.Host {
+		files, size, err = withSFTP(node, func(client *ssh.Client, sc *sftp.Client) (int, int64, error) {
+			return sftpPull(sc, remotePath, dir)
+		})
+		return MethodSFTP, files, size, err
+	}
+	files, size, err = dockerPull(node, containerOf(node, opts), remotePath, dir)
+	if err == nil || node.SSHKey == "" {
+		return MethodDocker, files, size, err
+	}
+	logger.L.Warnf("%s docker copy failed, trying sftp: %s", node.Name, err.Error())
+	// docker cp on the node into a temporary dir, then sftp
+	files, size, err = withSFTP(node, func(client *ssh.Client, sc *sftp.Client) (int, int64, error) {
+		tmp := tmpDir()
+		defer func() { _ = sshRun(client, "rm -rf "+shellQuote(tmp)) }()
+		if err := sshRun(client, fmt.Sprintf("mkdir -p %[1]s && docker cp %s %[1]s/", shellQuote(tmp), shellQuote(containerOf(node, opts)+":"+remotePath))); err != nil {
+			return 0, 0, err
+		}
+		return sftpPull(sc, path.Join(tmp, path.Base(remotePath)), dir)
+	})
+	return MethodSFTP, files, size, err
+}
+
+func pushNode(node inventory.Node, localPath, remoteDir string, opts CopyOptions) (method string, files int, size int64, err error) {
+	if opts.Host {
+		files, size, err = withSFTP(node, func(client *ssh.Client, sc *sftp.Client) (int, int64, error) {
+			return sftpPush(sc, localPath, remoteDir)
+		})
+		return MethodSFTP, files, size, err
+	}
+	files, size, err = dockerPush(node, containerOf(node, opts), localPath, remoteDir)
+	if err == nil || node.SSHKey == "" {
+		return MethodDocker, files, size, err
+	}
+	logger.L.Warnf("%s docker copy failed, trying sftp: %s", node.Name, err.Error())
+	files, size, err = withSFTP(node, func(client *ssh.Client, sc *sftp.Client) (int, int64, error) {
+		tmp := tmpDir()
+		defer func() { _ = sshRun(client, "rm -rf "+shellQuote(tmp)) }()
+		if err := sc.MkdirAll(tmp); err != nil {
+			return 0, 0, err
+		}
+		files, size, err := sftpPush(sc, localPath, tmp)
+		if err != nil {
+			return files, size, err
+		}
+		err = sshRun(client, fmt.Sprintf("docker cp %s %s", shellQuote(path.Join(tmp, filepath.Base(localPath))), shellQuote(containerOf(node, opts)+":"+remoteDir)))
+		return files, size, err
+	})
+	return MethodSFTP, files, size, err
+}
+
+// shellQuote quotes s as one word of a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func tmpDir() string {
+	return fmt.Sprintf("/tmp/fx-cp-%d", time.Now().UnixNano())
+}
+
+func dockerPull(node inventory.Node, container, remotePath, dir string) (int, int64, error) {
+	cli, err := docker.NewCli(node.DockerEndpoint())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cli.Close()
+	reader, _, err := cli.CopyFromContainer(context.Background(), container, remotePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+	return docker.ExtractTar(reader, dir)
+}
+
+func dockerPush(node inventory.Node, container, localPath, remoteDir string) (int, int64, error) {
+	cli, err := docker.NewCli(node.DockerEndpoint())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cli.Close()
+	var buf bytes.Buffer
+	files, size, err := tarPath(&buf, localPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = cli.CopyToContainer(context.Background(), container, remoteDir, &buf, types.CopyToContainerOptions{})
+	return files, size, err
+}
+
+// tarPath writes localPath, a file or a directory, as a tar whose entries start with its base name
+func tarPath(w io.Writer, localPath string) (files int, size int64, err error) {
+	tw := tar.NewWriter(w)
+	parent := filepath.Dir(filepath.Clean(localPath))
+	err = filepath.Walk(localPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(parent, file)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(tw, f)
+		files++
+		size += n
+		return err
+	})
+	if err != nil {
+		return
+	}
+	return files, size, tw.Close()
+}
+
+func withSFTP(node inventory.Node, fn func(client *ssh.Client, sc *sftp.Client) (int, int64, error)) (int, int64, error) {
+	key, err := node.Key()
+	if err != nil {
+		return 0, 0, err
+	}
+	client, err := aws.DialSSH(node.PublicIP, key)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer client.Close()
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sc.Close()
+	return fn(client, sc)
+}
+
+func sshRun(client *ssh.Client, command string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	if err = session.Run(command); err != nil {
+		return fmt.Errorf("%s: %s %s", command, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sftpPull copies remotePath, a file or a directory, under dir
+func sftpPull(sc *sftp.Client, remotePath, dir string) (files int, size int64, err error) {
+	parent := path.Dir(path.Clean(remotePath))
+	walker := sc.Walk(remotePath)
+	for walker.Step() {
+		if err = walker.Err(); err != nil {
+			return
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), parent), "/")
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		info := walker.Stat()
+		if info.IsDir() {
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		var f *sftp.File
+		if f, err = sc.Open(walker.Path()); err != nil {
+			return
+		}
+		n, copyErr := docker.WriteFile(target, info.Mode().Perm(), f)
+		_ = f.Close()
+		if copyErr != nil {
+			return files, size, copyErr
+		}
+		files++
+		size += n
+	}
+	return
+}
+
+// sftpPush copies localPath, a file or a directory, into remoteDir
+func sftpPush(sc *sftp.Client, localPath, remoteDir string) (files int, size int64, err error) {
+	parent := filepath.Dir(filepath.Clean(localPath))
+	err = filepath.Walk(localPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(parent, file)
+		if err != nil {
+			return err
+		}
+		target := path.Join(remoteDir, filepath.ToSlash(rel))
+		if info.IsDir() {
+			return sc.MkdirAll(target)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := sc.Create(target)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+		n, err := io.Copy(dst, src)
+		if err != nil {
+			return err
+		}
+		files++
+		size += n
+		return sc.Chmod(target, info.Mode().Perm())
+	})
+	return
+}
@@ -0,0 +1,91 @@
+package fleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewCpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "copy files between the containers of the nodes and the local host",
+		Long: `One of src and dst is <nodes>:<path>, nodes being a comma list of names or IPs, or * for every node.
+A pull writes into the local directory dst, into dst/<node> when there are several nodes.
+A push copies the local file or directory src into the existing remote directory dst.
+The docker API is used first, sftp over the node key when it fails or with --host.`,
+		Example: "fx cp --network test '*:/root/.fx/config/genesis.json' ./genesis\n" +
+			"fx cp --network test ./config.toml validator-0,validator-1:/root/.fx/config\n" +
+			"fx cp --network test --host seed:/var/log/syslog ./logs",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			src, dst := ParseLocation(args[0]), ParseLocation(args[1])
+			if src.Remote == dst.Remote {
+				return errors.New("exactly one of src and dst must be <nodes>:<path>")
+			}
+			remote := src
+			if dst.Remote {
+				remote = dst
+			}
+			nodes, err := SelectNodes(viper.GetString("network"), remote.Nodes, viper.GetString("role"))
+			if err != nil {
+				return err
+			}
+			opts := CopyOptions{
+				Parallel:  viper.GetInt("parallel"),
+				Container: viper.GetString("container"),
+				Host:      viper.GetBool("host"),
+			}
+			var results []CopyResult
+			if src.Remote {
+				results = Pull(nodes, src.Path, dst.Path, opts)
+			} else {
+				results = Push(nodes, src.Path, dst.Path, opts)
+			}
+
+			if viper.GetString("output") == OutputJSON {
+				data, err := json.MarshalIndent(results, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+			} else {
+				WriteCopySummary(os.Stdout, results)
+			}
+			var failed int
+			for _, result := range results {
+				if result.Error != "" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed on %d of %d nodes", failed, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("network", "", "inventory network")
+	cmd.Flags().String("role", "", "only the nodes of this role")
+	cmd.Flags().Int("parallel", 10, "hosts at once")
+	cmd.Flags().String("container", "", "container of the remote path, the node container by default")
+	cmd.Flags().Bool("host", false, "copy from or to the host filesystem over sftp instead of the container")
+	cmd.Flags().String("output", "", "json for the results as json, a summary otherwise")
+	_ = cmd.MarkFlagRequired("network")
+	return cmd
+}
+
+// WriteCopySummary one line per host with the method used, files, bytes and error
+func WriteCopySummary(w io.Writer, results []CopyResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tHOST\tMETHOD\tFILES\tBYTES\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", result.Node, result.Host, result.Method, result.Files, result.Bytes, result.Error)
+	}
+	_ = tw.Flush()
+}
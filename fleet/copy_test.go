@@ -0,0 +1,53 @@
+package fleet
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fx-tools/docker"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocation(t *testing.T) {
+	assert.Equal(t, Location{Path: "./genesis.json"}, ParseLocation("./genesis.json"))
+	assert.Equal(t, Location{Path: "/tmp/a:b"}, ParseLocation("/tmp/a:b"))
+	assert.Equal(t, Location{Remote: true, Path: "/root"}, ParseLocation("*:/root"))
+	assert.Equal(t, Location{Remote: true, Nodes: []string{"validator-0", "seed"}, Path: "/root"}, ParseLocation("validator-0,seed:/root"))
+	assert.Equal(t, Location{Remote: true, Nodes: []string{"10.0.0.1"}, Path: "/root"}, ParseLocation("10.0.0.1:/root"))
+	assert.Equal(t, Location{Path: `C:\genesis.json`}, ParseLocation(`C:\genesis.json`))
+	assert.Equal(t, Location{Path: "d:/fx/config"}, ParseLocation("d:/fx/config"))
+	assert.Equal(t, Location{Remote: true, Nodes: []string{"seed"}, Path: `C:\x`}, ParseLocation(`seed:C:\x`))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/root/my dir'`, shellQuote("/root/my dir"))
+	assert.Equal(t, `'it'\''s;rm -rf /'`, shellQuote("it's;rm -rf /"))
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "fx-cp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(src)
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "config", "sub"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "config", "a.toml"), []byte("a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "config", "sub", "b"), []byte("bb"), 0600))
+
+	var buf bytes.Buffer
+	files, size, err := tarPath(&buf, filepath.Join(src, "config"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.EqualValues(t, 3, size)
+
+	dst := filepath.Join(src, "out")
+	files, size, err = docker.ExtractTar(&buf, dst)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, files)
+	assert.EqualValues(t, 3, size)
+	data, err := ioutil.ReadFile(filepath.Join(dst, "config", "sub", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "bb", string(data))
+}
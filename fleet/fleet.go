@@ -0,0 +1,193 @@
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"fx-tools/aws"
+	"fx-tools/inventory"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExitUnknown the exit code of a command that did not run to completion
+const ExitUnknown = -1
+
+// Result of a command on one node
+type Result struct {
+	Node     string  `json:"node"`
+	Host     string  `json:"host"`
+	ExitCode int     `json:"exit_code"`
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+	Error    string  `json:"error,omitempty"`
+	Seconds  float64 `json:"seconds"`
+}
+
+func (r Result) OK() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+type Options struct {
+	// Parallel hosts at once, 1 when not positive
+	Parallel int
+	// Timeout of the command on one host, including the connection, none when zero
+	Timeout time.Duration
+	// OnLine gets every output line as it comes, nil to only collect the output
+	OnLine func(node string, stderr bool, line string)
+	// OnDone gets every result as soon as its host is done
+	OnDone func(result Result)
+}
+
+// Run runs command on every node over ssh, the results are in the order of nodes
+func Run(nodes []inventory.Node, command string, opts Options) []Result {
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	results := make([]Result, len(nodes))
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, node inventory.Node) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = runOne(node, command, opts)
+			if opts.OnDone != nil {
+				opts.OnDone(results[i])
+			}
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+func runOne(node inventory.Node, command string, opts Options) (result Result) {
+	start := time.Now()
+	result = Result{Node: node.Name, Host: node.PublicIP, ExitCode: ExitUnknown}
+	stdout := newLineWriter(node.Name, false, opts.OnLine)
+	stderr := newLineWriter(node.Name, true, opts.OnLine)
+	defer func() {
+		stdout.Flush()
+		stderr.Flush()
+		result.Stdout, result.Stderr = stdout.String(), stderr.String()
+		result.Seconds = time.Since(start).Seconds()
+	}()
+
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	done := make(chan error, 1)
+	var client *ssh.Client
+	var closed bool
+	var mu sync.Mutex
+	go func() {
+		done <- func() error {
+			key, err := node.Key()
+			if err != nil {
+				return err
+			}
+			c, err := aws.DialSSH(node.PublicIP, key)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			client = c
+			if closed {
+				// timed out while dialing
+				mu.Unlock()
+				return c.Close()
+			}
+			mu.Unlock()
+			session, err := c.NewSession()
+			if err != nil {
+				return err
+			}
+			defer session.Close()
+			session.Stdout, session.Stderr = stdout, stderr
+			return session.Run(command)
+		}()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timeout:
+		err = fmt.Errorf("timeout after %s", opts.Timeout)
+	}
+	mu.Lock()
+	closed = true
+	if client != nil {
+		// also ends a session still running after the timeout
+		_ = client.Close()
+	}
+	mu.Unlock()
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+	default:
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// lineWriter keeps the output and hands every complete line to onLine
+type lineWriter struct {
+	mu      sync.Mutex
+	node    string
+	stderr  bool
+	onLine  func(node string, stderr bool, line string)
+	all     bytes.Buffer
+	partial bytes.Buffer
+}
+
+func newLineWriter(node string, stderr bool, onLine func(string, bool, string)) *lineWriter {
+	return &lineWriter{node: node, stderr: stderr, onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.all.Write(p)
+	if w.onLine == nil {
+		return len(p), nil
+	}
+	w.partial.Write(p)
+	for {
+		i := bytes.IndexByte(w.partial.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(w.partial.Next(i + 1))
+		w.onLine(w.node, w.stderr, line[:len(line)-1])
+	}
+	return len(p), nil
+}
+
+// Flush hands the last line without a newline to onLine
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.onLine != nil && w.partial.Len() > 0 {
+		w.onLine(w.node, w.stderr, w.partial.String())
+		w.partial.Reset()
+	}
+}
+
+func (w *lineWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.all.String()
+}
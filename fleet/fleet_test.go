@@ -0,0 +1,22 @@
+package fleet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := newLineWriter("node0", false, func(node string, stderr bool, line string) {
+		assert.Equal(t, "node0", node)
+		lines = append(lines, line)
+	})
+	_, _ = w.Write([]byte("a\nb"))
+	_, _ = w.Write([]byte("c\n\nd"))
+	assert.Equal(t, []string{"a", "bc", ""}, lines)
+
+	w.Flush()
+	assert.Equal(t, []string{"a", "bc", "", "d"}, lines)
+	assert.Equal(t, "a\nbc\n\nd", w.String())
+}
@@ -0,0 +1,191 @@
+package fleet
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fx-tools/docker"
+	"fx-tools/inventory"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxLogLine the longest log line kept whole, longer ones are split
+const maxLogLine = 1024 * 1024
+
+var (
+	tmLogLine = regexp.MustCompile(`^([DIEW])\[([^\]]+)\] (.*)$`)
+	tmLogKey  = regexp.MustCompile(`\s+[A-Za-z_][\w.\-]*=`)
+	tmLogPair = regexp.MustCompile(`([A-Za-z_][\w.\-]*)=("(?:[^"\\]|\\.)*"|\S*)`)
+	tmLevels  = map[string]string{"D": "debug", "I": "info", "W": "warn", "E": "error"}
+)
+
+// ParseLogLine parses a tendermint log line such as
+// I[2020-10-23|03:50:49.123] Executed block    module=state height=1
+// into its level, time, msg and key=value fields, false when line is not in this format
+func ParseLogLine(line string) (map[string]string, bool) {
+	match := tmLogLine.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	fields := map[string]string{"level": tmLevels[match[1]], "time": match[2]}
+	if t, err := time.Parse("2006-01-02|15:04:05.000", match[2]); err == nil {
+		fields["time"] = t.Format(time.RFC3339Nano)
+	}
+	rest := match[3]
+	msg := rest
+	if loc := tmLogKey.FindStringIndex(rest); loc != nil {
+		msg = rest[:loc[0]]
+		for _, pair := range tmLogPair.FindAllStringSubmatch(rest[loc[0]:], -1) {
+			value := pair[2]
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			// the fixed fields win over a key of the same name
+			if _, ok := fields[pair[1]]; !ok {
+				fields[pair[1]] = value
+			}
+		}
+	}
+	fields["msg"] = strings.TrimSpace(msg)
+	return fields, true
+}
+
+type LogOptions struct {
+	Follow bool
+	// Since a timestamp or a duration like 10m, every line when empty
+	Since string
+	// Tail lines from the end of the logs, all of them when empty
+	Tail string
+	// ArchiveDir appends every line of a node to ArchiveDir/<node>.log, no archive when empty
+	ArchiveDir string
+	// OnLine gets every line of the container
+	OnLine func(node string, stderr bool, line string)
+}
+
+// LogResult of the logs of one node
+type LogResult struct {
+	Node  string `json:"node"`
+	Host  string `json:"host"`
+	Lines int    `json:"lines"`
+	Error string `json:"error,omitempty"`
+}
+
+// StreamLogs streams the logs of the container of every node at once until they end, or ctx is done when following
+func StreamLogs(ctx context.Context, nodes []inventory.Node, opts LogOptions) []LogResult {
+	results := make([]LogResult, len(nodes))
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node inventory.Node) {
+			defer wg.Done()
+			results[i] = LogResult{Node: node.Name, Host: node.PublicIP}
+			lines, err := streamNode(ctx, node, opts)
+			results[i].Lines = lines
+			if err != nil && ctx.Err() == nil {
+				results[i].Error = err.Error()
+			}
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+func streamNode(ctx context.Context, node inventory.Node, opts LogOptions) (int, error) {
+	var archive io.Writer
+	if opts.ArchiveDir != "" {
+		if err := os.MkdirAll(opts.ArchiveDir, 0755); err != nil {
+			return 0, err
+		}
+		f, err := os.OpenFile(filepath.Join(opts.ArchiveDir, node.Name+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		archive = f
+	}
+
+	cli, err := docker.NewCli(node.DockerEndpoint())
+	if err != nil {
+		return 0, err
+	}
+	defer cli.Close()
+	reader, err := cli.ContainerLogs(ctx, node.ContainerName(), types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Since:      opts.Since,
+		Tail:       opts.Tail,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var mu sync.Mutex
+	var lines int
+	onLine := func(stderr bool, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines++
+		if archive != nil {
+			_, _ = io.WriteString(archive, line+"\n")
+		}
+		if opts.OnLine != nil {
+			opts.OnLine(node.Name, stderr, line)
+		}
+	}
+	stdout, stdoutDone := scanLines(func(line string) { onLine(false, line) })
+	stderr, stderrDone := scanLines(func(line string) { onLine(true, line) })
+	_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	_ = stdout.Close()
+	_ = stderr.Close()
+	for _, done := range []<-chan error{stdoutDone, stderrDone} {
+		if scanErr := <-done; scanErr != nil && err == nil {
+			err = scanErr
+		}
+	}
+	return lines, err
+}
+
+// scanLines hands every line written to the returned writer to onLine, a line longer than maxLogLine
+// in pieces. The channel gets the read error, nil at the end, once the writer is closed and scanned
+func scanLines(onLine func(line string)) (io.WriteCloser, <-chan error) {
+	r, w := io.Pipe()
+	ch := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReaderSize(r, 64*1024)
+		var line []byte
+		for {
+			chunk, isPrefix, err := reader.ReadLine()
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				// the writer must not block once reading stopped
+				_ = r.CloseWithError(err)
+				ch <- err
+				return
+			}
+			line = append(line, chunk...)
+			for len(line) > maxLogLine {
+				onLine(string(line[:maxLogLine]))
+				line = line[maxLogLine:]
+			}
+			if !isPrefix {
+				onLine(string(line))
+				line = line[:0]
+			}
+		}
+	}()
+	return w, ch
+}
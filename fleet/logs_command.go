@@ -0,0 +1,107 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "stream the logs of the fx-chain container of the nodes through the docker API",
+		Example: "fx logs --network test --follow --grep 'Executed block'\n" +
+			"fx logs --network test --since 10m --json --archive ./run-1",
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			nodes, err := SelectNodes(viper.GetString("network"), viper.GetStringSlice("node"), viper.GetString("role"))
+			if err != nil {
+				return err
+			}
+			var grep *regexp.Regexp
+			if expr := viper.GetString("grep"); expr != "" {
+				if grep, err = regexp.Compile(expr); err != nil {
+					return err
+				}
+			}
+			asJSON := viper.GetBool("json")
+			width := nameWidth(nodes)
+			var mu sync.Mutex
+			opts := LogOptions{
+				Follow:     viper.GetBool("follow"),
+				Since:      viper.GetString("since"),
+				Tail:       viper.GetString("tail"),
+				ArchiveDir: viper.GetString("archive"),
+				OnLine: func(node string, stderr bool, line string) {
+					if grep != nil && !grep.MatchString(line) {
+						return
+					}
+					out := fmt.Sprintf("%-*s | %s", width, node, line)
+					if asJSON {
+						fields, ok := ParseLogLine(line)
+						if !ok {
+							fields = map[string]string{"msg": line}
+						}
+						fields["node"] = node
+						data, err := json.Marshal(fields)
+						if err != nil {
+							return
+						}
+						out = string(data)
+					}
+					w := os.Stdout
+					if stderr && !asJSON {
+						w = os.Stderr
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					fmt.Fprintln(w, out)
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sig)
+			go func() {
+				select {
+				case <-sig:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			var failed int
+			for _, result := range StreamLogs(ctx, nodes, opts) {
+				if result.Error != "" {
+					failed++
+					fmt.Fprintf(os.Stderr, "%s (%s): %s\n", result.Node, result.Host, result.Error)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed on %d of %d nodes", failed, len(nodes))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("network", "", "inventory network")
+	cmd.Flags().StringSlice("node", nil, "node names or IPs, every node by default")
+	cmd.Flags().String("role", "", "only the nodes of this role")
+	cmd.Flags().BoolP("follow", "f", false, "keep streaming new lines until interrupted")
+	cmd.Flags().String("since", "", "only the lines since a timestamp or a duration like 10m")
+	cmd.Flags().String("tail", "all", "lines from the end of the logs of every node")
+	cmd.Flags().String("grep", "", "only print the lines matching this regular expression, the archive keeps every line")
+	cmd.Flags().Bool("json", false, "print the tendermint key=value lines as json objects")
+	cmd.Flags().String("archive", "", "append the lines of every node to <dir>/<node>.log")
+	_ = cmd.MarkFlagRequired("network")
+	return cmd
+}
@@ -0,0 +1,48 @@
+package fleet
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLine(t *testing.T) {
+	fields, ok := ParseLogLine(`I[2020-10-23|03:50:49.123] Executed block                               module=state height=12 validTxs=0 err="no peer: a=b"`)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{
+		"level":    "info",
+		"time":     "2020-10-23T03:50:49.123Z",
+		"msg":      "Executed block",
+		"module":   "state",
+		"height":   "12",
+		"validTxs": "0",
+		"err":      "no peer: a=b",
+	}, fields)
+
+	fields, ok = ParseLogLine(`E[2020-10-23|03:50:49.123] Stopping peer for error`)
+	assert.True(t, ok)
+	assert.Equal(t, "error", fields["level"])
+	assert.Equal(t, "Stopping peer for error", fields["msg"])
+
+	_, ok = ParseLogLine("panic: runtime error")
+	assert.False(t, ok)
+}
+
+func TestScanLines(t *testing.T) {
+	var lines []string
+	w, done := scanLines(func(line string) { lines = append(lines, line) })
+	long := strings.Repeat("x", maxLogLine+10)
+	_, err := io.WriteString(w, "a\n"+long+"\nb\nc")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, <-done)
+	// the long line is split and the lines after it are kept
+	assert.Equal(t, []string{"a", long[:maxLogLine], long[maxLogLine:], "b", "c"}, lines)
+
+	w, done = scanLines(func(string) {})
+	assert.NoError(t, w.(*io.PipeWriter).CloseWithError(errors.New("reset")))
+	assert.EqualError(t, <-done, "reset")
+}
@@ -10,6 +10,7 @@ require (
 	github.com/docker/go-connections v0.4.0
 	github.com/ethereum/go-ethereum v1.9.19
 	github.com/gizak/termui/v3 v3.1.0
+	github.com/pkg/sftp v1.11.0
 	github.com/prometheus/client_golang v1.7.0
 	github.com/prometheus/common v0.10.0
 	github.com/prometheus/prometheus v0.0.0-20200531074256-58c445e6efdf
@@ -18,6 +19,7 @@ require (
 	github.com/stretchr/testify v1.6.1
 	github.com/tendermint/go-amino v0.15.1
 	github.com/tendermint/tendermint v0.33.3
+	github.com/tendermint/tm-db v0.5.1
 	go.uber.org/zap v1.13.0
 	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
 	gopkg.in/yaml.v2 v2.3.0
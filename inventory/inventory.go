@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ProviderAWS    = "aws"
+	ProviderDocker = "docker"
+
+	RoleValidator = "validator"
+	RoleNormal    = "normal"
+	RoleSeed      = "seed"
+	RoleSentry    = "sentry"
+
+	DefContainer  = "fx-chain"
+	DefRPCPort    = 26657
+	DefP2PPort    = 26656
+	DefDockerPort = 2376
+)
+
+// Dir is where every network inventory is stored, one json file per network
+var Dir = "./networks"
+
+type Node struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	PublicIP     string `json:"public_ip"`
+	PrivateIP    string `json:"private_ip"`
+	DockerHost   string `json:"docker_host,omitempty"`
+	Container    string `json:"container,omitempty"`
+	RPCPort      uint   `json:"rpc_port,omitempty"`
+	StackName    string `json:"stack_name,omitempty"`
+	InstanceID   string `json:"instance_id,omitempty"`
+	Region       string `json:"region,omitempty"`
+	InstanceType string `json:"instance_type,omitempty"`
+	Market       string `json:"market,omitempty"` // spot or on-demand
+	NodeID       string `json:"node_id,omitempty"`
+	SSHKey       string `json:"ssh_key,omitempty"`
+}
+
+// DockerEndpoint the docker daemon managing the node container
+func (n Node) DockerEndpoint() string {
+	if n.DockerHost != "" {
+		return n.DockerHost
+	}
+	return fmt.Sprintf("tcp://%s:%d", n.PublicIP, DefDockerPort)
+}
+
+func (n Node) ContainerName() string {
+	if n.Container != "" {
+		return n.Container
+	}
+	return DefContainer
+}
+
+func (n Node) RPC() string {
+	port := n.RPCPort
+	if port == 0 {
+		port = DefRPCPort
+	}
+	return fmt.Sprintf("http://%s:%d", n.PublicIP, port)
+}
+
+// IPs the addresses peers may use to reach the node, private first
+func (n Node) IPs() []string {
+	var ips []string
+	for _, ip := range []string{n.PrivateIP, n.PublicIP} {
+		if ip == "" || strings.HasPrefix(ip, "127.") || (len(ips) > 0 && ips[0] == ip) {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+type Network struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	ChainID  string `json:"chain_id,omitempty"`
+	Nodes    []Node `json:"nodes"`
+}
+
+func New(name, provider string) *Network {
+	return &Network{Name: name, Provider: provider, Nodes: make([]Node, 0)}
+}
+
+func Path(name string) string {
+	return filepath.Join(Dir, fmt.Sprintf("%s.json", name))
+}
+
+func Load(name string) (*Network, error) {
+	if name == "" {
+		return nil, errors.New("network name can not be empty")
+	}
+	data, err := ioutil.ReadFile(Path(name))
+	if err != nil {
+		return nil, err
+	}
+	var network Network
+	if err = json.Unmarshal(data, &network); err != nil {
+		return nil, fmt.Errorf("parse network %s: %s", name, err.Error())
+	}
+	return &network, nil
+}
+
+// LoadOrNew returns the saved network, or an empty one if it has not been saved yet
+func LoadOrNew(name, provider string) (*Network, error) {
+	network, err := Load(name)
+	if os.IsNotExist(err) {
+		return New(name, provider), nil
+	}
+	return network, err
+}
+
+func (n *Network) Save() error {
+	if err := os.MkdirAll(Dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(Path(n.Name), data, 0644)
+}
+
+// AddNode adds the node, replacing any node with the same name
+func (n *Network) AddNode(node Node) {
+	for i := range n.Nodes {
+		if n.Nodes[i].Name == node.Name {
+			n.Nodes[i] = node
+			return
+		}
+	}
+	n.Nodes = append(n.Nodes, node)
+}
+
+func (n *Network) RemoveNode(name string) bool {
+	for i := range n.Nodes {
+		if n.Nodes[i].Name == name {
+			n.Nodes = append(n.Nodes[:i], n.Nodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Node finds a node by name, public or private IP
+func (n *Network) Node(key string) (Node, bool) {
+	for _, node := range n.Nodes {
+		if node.Name == key || node.PublicIP == key || node.PrivateIP == key {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+// Select returns the nodes matching keys, or every node when keys is empty
+func (n *Network) Select(keys []string) ([]Node, error) {
+	if len(keys) <= 0 {
+		return n.Nodes, nil
+	}
+	var nodes []Node
+	for _, key := range keys {
+		node, ok := n.Node(key)
+		if !ok {
+			return nil, fmt.Errorf("node %s not found in network %s", key, n.Name)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (n *Network) ByRole(role string) []Node {
+	var nodes []Node
+	for _, node := range n.Nodes {
+		if node.Role == role {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
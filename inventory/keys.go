@@ -0,0 +1,45 @@
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefKeyNetwork holds the keys of the instances deployed without a network
+const DefKeyNetwork = "default"
+
+// KeyDir where the ssh private keys of the nodes of network are stored
+func KeyDir(network string) string {
+	if network == "" {
+		network = DefKeyNetwork
+	}
+	return filepath.Join(Dir, "keys", network)
+}
+
+// KeyPath the private key of the instance of stackName on ip
+func KeyPath(network, stackName, ip string) string {
+	return filepath.Join(KeyDir(network), fmt.Sprintf("%s_%s.pem", stackName, ip))
+}
+
+// SaveKey writes the private key readable by the owner only and returns its path
+func SaveKey(network, stackName, ip string, key []byte) (string, error) {
+	if err := os.MkdirAll(KeyDir(network), 0700); err != nil {
+		return "", err
+	}
+	path := KeyPath(network, stackName, ip)
+	if err := ioutil.WriteFile(path, key, 0600); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of an existing file
+	return path, os.Chmod(path, 0600)
+}
+
+// Key the ssh private key of the node
+func (n Node) Key() ([]byte, error) {
+	if n.SSHKey == "" {
+		return nil, fmt.Errorf("node %s has no ssh key", n.Name)
+	}
+	return ioutil.ReadFile(n.SSHKey)
+}
@@ -0,0 +1,53 @@
+package inventory
+
+import (
+	"fmt"
+)
+
+const (
+	DefPrometheusPort   = 26660
+	DefNodeExporterPort = 9100
+)
+
+// TargetGroup a target group of a Prometheus file_sd_configs file
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// PromTargets one target group per node on port, labelled with the network, node and role.
+// Prometheus runs next to the nodes so the private address is preferred, unless the nodes span
+// several regions, whose private addresses do not route to each other
+func (n *Network) PromTargets(port uint) []TargetGroup {
+	multiRegion := n.multiRegion()
+	var groups []TargetGroup
+	for _, node := range n.Nodes {
+		ip := node.PrivateIP
+		if ip == "" || multiRegion && node.PublicIP != "" {
+			ip = node.PublicIP
+		}
+		if ip == "" {
+			continue
+		}
+		groups = append(groups, TargetGroup{
+			Targets: []string{fmt.Sprintf("%s:%d", ip, port)},
+			Labels:  map[string]string{"network": n.Name, "node": node.Name, "role": node.Role},
+		})
+	}
+	return groups
+}
+
+// multiRegion whether the nodes were launched in more than one region
+func (n *Network) multiRegion() bool {
+	var region string
+	for _, node := range n.Nodes {
+		if node.Region == "" {
+			continue
+		}
+		if region != "" && node.Region != region {
+			return true
+		}
+		region = node.Region
+	}
+	return false
+}
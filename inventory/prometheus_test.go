@@ -0,0 +1,24 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromTargets(t *testing.T) {
+	network := &Network{Name: "test", Nodes: []Node{
+		{Name: "val-0", Role: RoleValidator, PublicIP: "3.0.0.1", PrivateIP: "10.0.0.1", Region: "us-east-2"},
+		{Name: "val-1", Role: RoleValidator, PublicIP: "3.0.0.2", PrivateIP: "10.0.0.2", Region: "us-east-2"},
+	}}
+	groups := network.PromTargets(DefPrometheusPort)
+	assert.Equal(t, []string{"10.0.0.1:26660"}, groups[0].Targets)
+	assert.Equal(t, map[string]string{"network": "test", "node": "val-0", "role": RoleValidator}, groups[0].Labels)
+	assert.Equal(t, []string{"10.0.0.2:26660"}, groups[1].Targets)
+
+	// private addresses do not route between regions
+	network.Nodes[1].Region = "eu-west-1"
+	groups = network.PromTargets(DefPrometheusPort)
+	assert.Equal(t, []string{"3.0.0.1:26660"}, groups[0].Targets)
+	assert.Equal(t, []string{"3.0.0.2:26660"}, groups[1].Targets)
+}
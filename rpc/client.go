@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tendermint/go-amino"
+	coreTypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// Client a plain tendermint JSON-RPC over HTTP client for the endpoints hub/client does not cover
+type Client struct {
+	Remote string
+	cdc    *amino.Codec
+	http   *http.Client
+}
+
+func NewClient(remote string) *Client {
+	cdc := amino.NewCodec()
+	coreTypes.RegisterAmino(cdc)
+	return &Client{Remote: remote, cdc: cdc, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+func (c *Client) call(method string, params url.Values, result interface{}) error {
+	u := fmt.Sprintf("%s/%s", c.Remote, method)
+	if len(params) > 0 {
+		u = fmt.Sprintf("%s?%s", u, params.Encode())
+	}
+	resp, err := c.http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var response rpcResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("%s: %s", method, err.Error())
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s code: %d, msg: %s, data: %s", method, response.Error.Code, response.Error.Message, response.Error.Data)
+	}
+	return c.cdc.UnmarshalJSON(response.Result, result)
+}
+
+func heightParams(height int64) url.Values {
+	params := url.Values{}
+	if height > 0 {
+		params.Set("height", strconv.FormatInt(height, 10))
+	}
+	return params
+}
+
+func (c *Client) Status() (*coreTypes.ResultStatus, error) {
+	result := new(coreTypes.ResultStatus)
+	if err := c.call("status", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) NetInfo() (*coreTypes.ResultNetInfo, error) {
+	result := new(coreTypes.ResultNetInfo)
+	if err := c.call("net_info", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) DumpConsensusState() (*coreTypes.ResultDumpConsensusState, error) {
+	result := new(coreTypes.ResultDumpConsensusState)
+	if err := c.call("dump_consensus_state", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) NumUnconfirmedTxs() (*coreTypes.ResultUnconfirmedTxs, error) {
+	result := new(coreTypes.ResultUnconfirmedTxs)
+	if err := c.call("num_unconfirmed_txs", nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Block the block at height, the latest block if height is 0
+func (c *Client) Block(height int64) (*coreTypes.ResultBlock, error) {
+	result := new(coreTypes.ResultBlock)
+	if err := c.call("block", heightParams(height), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) BlockResults(height int64) (*coreTypes.ResultBlockResults, error) {
+	result := new(coreTypes.ResultBlockResults)
+	if err := c.call("block_results", heightParams(height), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) Commit(height int64) (*coreTypes.ResultCommit, error) {
+	result := new(coreTypes.ResultCommit)
+	if err := c.call("commit", heightParams(height), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) Validators(height int64, page, perPage int) (*coreTypes.ResultValidators, error) {
+	params := heightParams(height)
+	if page > 0 {
+		params.Set("page", strconv.Itoa(page))
+	}
+	if perPage > 0 {
+		params.Set("per_page", strconv.Itoa(perPage))
+	}
+	result := new(coreTypes.ResultValidators)
+	if err := c.call("validators", params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ABCIQuery queries the application, failing on a non zero response code
+func (c *Client) ABCIQuery(path string, data []byte) (*coreTypes.ResultABCIQuery, error) {
+	params := url.Values{}
+	params.Set("path", strconv.Quote(path))
+	if len(data) > 0 {
+		params.Set("data", fmt.Sprintf("0x%X", data))
+	}
+	result := new(coreTypes.ResultABCIQuery)
+	if err := c.call("abci_query", params, result); err != nil {
+		return nil, err
+	}
+	if result.Response.Code != 0 {
+		return nil, fmt.Errorf("abci query %s code: %d, log: %s", path, result.Response.Code, result.Response.Log)
+	}
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	cstypes "github.com/tendermint/tendermint/consensus/types"
+	tmTypes "github.com/tendermint/tendermint/types"
+)
+
+// nilVote is how VoteSet.VoteStrings prints a validator that has not voted
+const nilVote = "nil-Vote"
+
+// RoundVotes the votes of one round as dumped by HeightVoteSet, indexed like the validator set
+type RoundVotes struct {
+	Round      int      `json:"round"`
+	Prevotes   []string `json:"prevotes"`
+	Precommits []string `json:"precommits"`
+}
+
+// RoundState the part of the /dump_consensus_state round state needed to diagnose a stall
+type RoundState struct {
+	Height     int64                 `json:"height"`
+	Round      int                   `json:"round"`
+	Step       cstypes.RoundStepType `json:"step"`
+	Validators *tmTypes.ValidatorSet `json:"validators"`
+	Votes      []RoundVotes          `json:"votes"`
+}
+
+func (c *Client) DecodeRoundState(data json.RawMessage) (*RoundState, error) {
+	var rs RoundState
+	if err := c.cdc.UnmarshalJSON(data, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// RoundVotes the votes of the current round
+func (rs *RoundState) RoundVotes() (RoundVotes, bool) {
+	for _, votes := range rs.Votes {
+		if votes.Round == rs.Round {
+			return votes, true
+		}
+	}
+	return RoundVotes{}, false
+}
+
+// MissingVotes the validators whose vote is absent, and their voting power
+func MissingVotes(validators []*tmTypes.Validator, votes []string) (missing []*tmTypes.Validator, power int64) {
+	for i, validator := range validators {
+		if i < len(votes) && votes[i] != nilVote {
+			continue
+		}
+		missing = append(missing, validator)
+		power += validator.VotingPower
+	}
+	return
+}
@@ -0,0 +1,195 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"hub/client"
+	"hub/logger"
+
+	"github.com/tendermint/go-amino"
+	coreTypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmTypes "github.com/tendermint/tendermint/types"
+)
+
+// NewBlock a block delivered by BlockSubscription, Backfill when it was fetched by height after a gap
+type NewBlock struct {
+	Block    *tmTypes.Block
+	Backfill bool
+}
+
+// BlockSubscription delivers every new block in height order over websocket reconnects,
+// the heights missed while disconnected are fetched from /block
+type BlockSubscription struct {
+	Remote     string
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxBackfill the most blocks fetched for one gap, the oldest are skipped, 0 for no limit
+	MaxBackfill int64
+
+	OnConnect    func()
+	OnDisconnect func(err error)
+	// OnGap the heights [from, to] were not received over the websocket
+	OnGap func(from, to int64)
+	// OnUnfilled the heights [from, to] of a gap that were neither fetched nor will be
+	OnUnfilled func(from, to int64)
+
+	client     *Client
+	cdc        *amino.Codec
+	lastHeight int64
+}
+
+func NewBlockSubscription(remote string) *BlockSubscription {
+	cdc := amino.NewCodec()
+	tmTypes.RegisterEventDatas(cdc)
+	cdc.Seal()
+	return &BlockSubscription{
+		Remote:      remote,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Minute,
+		MaxBackfill: 1000,
+		client:      NewClient(remote),
+		cdc:         cdc,
+	}
+}
+
+// Run subscribes and resubscribes with exponential backoff until ctx is done
+func (s *BlockSubscription) Run(ctx context.Context, blocks chan<- NewBlock) error {
+	backoff := s.MinBackoff
+	for {
+		start := time.Now()
+		connected, err := s.subscribe(ctx, blocks)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected && s.OnDisconnect != nil {
+			s.OnDisconnect(err)
+		}
+		// a subscription that lasted starts over from the shortest wait
+		if time.Since(start) > s.MaxBackoff {
+			backoff = s.MinBackoff
+		}
+		logger.L.Warnf("%s: %s, resubscribe in %s", s.Remote, err.Error(), backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+}
+
+// subscribe follows the new blocks until the websocket fails, connected tells whether OnConnect was called
+func (s *BlockSubscription) subscribe(ctx context.Context, blocks chan<- NewBlock) (connected bool, err error) {
+	ws, err := client.NewWsClient(s.cdc, fmt.Sprintf("%s/websocket", s.Remote))
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var responsesCh = make(chan client.RPCResponse, 1024)
+	if _, err = ws.Subscribe(subCtx, tmTypes.EventQueryNewBlock.String(), responsesCh); err != nil {
+		return false, err
+	}
+	if s.OnConnect != nil {
+		s.OnConnect()
+	}
+
+	for {
+		select {
+		case resp := <-responsesCh:
+			if resp.Error != nil {
+				logger.L.Errorf("response code: %d, data: %s, msg: %s", resp.Error.Code, resp.Error.Data, resp.Error.Message)
+				continue
+			}
+			var resultEvent coreTypes.ResultEvent
+			if err := s.cdc.UnmarshalJSON(resp.Result, &resultEvent); err != nil {
+				logger.L.Errorf("failed to unmarshal response err: %s", err)
+				continue
+			}
+			eventBlock, ok := resultEvent.Data.(tmTypes.EventDataNewBlock)
+			if !ok {
+				continue
+			}
+			if err = s.deliver(ctx, eventBlock.Block, blocks); err != nil {
+				return true, err
+			}
+		case <-ws.ExitCh():
+			return true, errors.New("websocket closed")
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+// deliver sends block after the blocks between it and the last delivered height
+func (s *BlockSubscription) deliver(ctx context.Context, block *tmTypes.Block, blocks chan<- NewBlock) error {
+	// a resubscription may repeat the last block
+	if s.lastHeight > 0 && block.Height <= s.lastHeight {
+		return nil
+	}
+	if s.lastHeight > 0 && block.Height > s.lastHeight+1 {
+		from, to := s.lastHeight+1, block.Height-1
+		if s.OnGap != nil {
+			s.OnGap(from, to)
+		}
+		if s.MaxBackfill > 0 && to-from+1 > s.MaxBackfill {
+			s.unfilled(from, to-s.MaxBackfill)
+			from = to - s.MaxBackfill + 1
+		}
+		for height := from; height <= to; height++ {
+			res, err := s.fetchBlock(ctx, height)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				logger.L.Warnf("%s: backfill height %d error: %s", s.Remote, height, err.Error())
+				s.unfilled(height, to)
+				break
+			}
+			if err = send(ctx, blocks, NewBlock{Block: res.Block, Backfill: true}); err != nil {
+				return err
+			}
+		}
+	}
+	s.lastHeight = block.Height
+	return send(ctx, blocks, NewBlock{Block: block})
+}
+
+// backfillRetries the attempts to fetch one missed block
+const backfillRetries = 3
+
+func (s *BlockSubscription) fetchBlock(ctx context.Context, height int64) (res *coreTypes.ResultBlock, err error) {
+	for i := 0; i < backfillRetries; i++ {
+		if res, err = s.client.Block(height); err == nil {
+			return res, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.MinBackoff):
+		}
+	}
+	return nil, err
+}
+
+func (s *BlockSubscription) unfilled(from, to int64) {
+	if s.OnUnfilled != nil {
+		s.OnUnfilled(from, to)
+	}
+}
+
+func send(ctx context.Context, blocks chan<- NewBlock, block NewBlock) error {
+	select {
+	case blocks <- block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}